@@ -0,0 +1,413 @@
+package domainutil
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LookupResolver is a resolver that reports TTLs and can be wrapped by a Cache.
+// *Resolver and *Cache implement it; SystemResolver adapts a *net.Resolver.
+type LookupResolver interface {
+	LookupIP(ctx context.Context, host string) ([]IPRecord, error)
+	LookupPTR(ctx context.Context, ip string) ([]Record, error)
+}
+
+// CacheOptions configures a Cache.
+type CacheOptions struct {
+	MaxEntries  int           // maximum number of cached names, least recently used are evicted first (default 10000)
+	MinTTL      time.Duration // lower bound applied to record TTLs (default 0)
+	MaxTTL      time.Duration // upper bound applied to record TTLs (default 1h)
+	NegativeTTL time.Duration // how long names that do not exist are cached (default 30s)
+}
+
+// DefaultCacheOptions returns the options used when fields of CacheOptions are left unset.
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{
+		MaxEntries:  10000,
+		MaxTTL:      time.Hour,
+		NegativeTTL: 30 * time.Second,
+	}
+}
+
+// CacheStats holds the counters of a Cache.
+type CacheStats struct {
+	Hits         uint64 `json:"hits"`          // lookups answered from a cached record set
+	NegativeHits uint64 `json:"negative_hits"` // lookups answered from a cached "not found" result
+	Misses       uint64 `json:"misses"`        // lookups sent to the underlying resolver
+	Evictions    uint64 `json:"evictions"`     // entries dropped to stay under MaxEntries
+	Entries      int    `json:"entries"`       // entries currently cached
+}
+
+// Cache is a DNS cache in front of a LookupResolver. Address and PTR lookups are cached for
+// the TTL of their records, and names that do not exist for NegativeTTL. Concurrent lookups
+// of the same name share a single query. Temporary failures are not cached.
+//
+// Besides LookupIP and LookupPTR, Cache provides LookupIPAddr, LookupAddr and DialContext so
+// it can be used wherever a *net.Resolver or a dial function is expected. It is safe for concurrent use.
+type Cache struct {
+	resolver LookupResolver
+	opts     CacheOptions
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // of *cacheEntry, most recently used first
+	inflight map[string]*cacheCall
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	ips     []IPRecord
+	ptrs    []Record
+	err     error // set for negative entries
+	expires time.Time
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// NewCache creates a Cache in front of resolver. If resolver is nil, the system resolver
+// is used with a TTL of one minute.
+func NewCache(resolver LookupResolver, opts CacheOptions) *Cache {
+	if resolver == nil {
+		resolver = SystemResolver(nil, time.Minute)
+	}
+	return &Cache{
+		resolver: resolver,
+		opts:     opts.withDefaults(),
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheCall),
+	}
+}
+
+var (
+	defaultCache     *Cache
+	defaultCacheOnce sync.Once
+)
+
+// DefaultCache returns a process-wide Cache in front of the system resolver, created on
+// first use. It is used by functions of other packages that resolve names without being
+// given a cache, such as urlutil.CanReachURL.
+func DefaultCache() *Cache {
+	defaultCacheOnce.Do(func() {
+		defaultCache = NewCache(nil, CacheOptions{})
+	})
+	return defaultCache
+}
+
+// LookupIP returns the addresses of host, from the cache if possible. The TTLs of
+// cached records are lowered by the time they have spent in the cache.
+func (c *Cache) LookupIP(ctx context.Context, host string) ([]IPRecord, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []IPRecord{{IP: ip}}, nil
+	}
+
+	host = normalizeName(host)
+	entry, err := c.get(ctx, "ip:"+host, func() (*cacheEntry, error) {
+		ips, err := c.resolver.LookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ttl := ^uint32(0)
+		for _, rec := range ips {
+			if rec.TTL < ttl {
+				ttl = rec.TTL
+			}
+		}
+		return &cacheEntry{ips: ips, expires: c.recordsExpiry(len(ips), ttl)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := remainingTTL(entry.expires)
+	ips := make([]IPRecord, len(entry.ips))
+	for i, rec := range entry.ips {
+		ips[i] = IPRecord{IP: rec.IP, TTL: minUint32(rec.TTL, remaining)}
+	}
+	return ips, nil
+}
+
+// LookupPTR returns the PTR records of an IP address, from the cache if possible.
+func (c *Cache) LookupPTR(ctx context.Context, ip string) ([]Record, error) {
+	key := "ptr:" + ip
+	if parsed := net.ParseIP(ip); parsed != nil {
+		key = "ptr:" + parsed.String()
+	}
+
+	entry, err := c.get(ctx, key, func() (*cacheEntry, error) {
+		ptrs, err := c.resolver.LookupPTR(ctx, ip)
+		if err != nil {
+			return nil, err
+		}
+		ttl := ^uint32(0)
+		for _, rec := range ptrs {
+			if rec.TTL < ttl {
+				ttl = rec.TTL
+			}
+		}
+		return &cacheEntry{ptrs: ptrs, expires: c.recordsExpiry(len(ptrs), ttl)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := remainingTTL(entry.expires)
+	ptrs := make([]Record, len(entry.ptrs))
+	for i, rec := range entry.ptrs {
+		rec.TTL = minUint32(rec.TTL, remaining)
+		ptrs[i] = rec
+	}
+	return ptrs, nil
+}
+
+// LookupIPAddr returns the addresses of host, like (*net.Resolver).LookupIPAddr.
+func (c *Cache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	records, err := c.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IPAddr, len(records))
+	for i, rec := range records {
+		addrs[i] = net.IPAddr{IP: rec.IP}
+	}
+	return addrs, nil
+}
+
+// LookupAddr returns the names of an IP address, like (*net.Resolver).LookupAddr.
+func (c *Cache) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	records, err := c.LookupPTR(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(records))
+	for i, rec := range records {
+		names[i] = rec.Target + "."
+	}
+	return names, nil
+}
+
+// DialContext connects to address ("host:port") after resolving host through the cache,
+// trying each address in turn. It can be used as the DialContext of an http.Transport.
+func (c *Cache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var lastErr error
+	for _, rec := range records {
+		if v4 := rec.IP.To4() != nil; strings.HasSuffix(network, "4") && !v4 || strings.HasSuffix(network, "6") && v4 {
+			continue
+		}
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(rec.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	return nil, lastErr
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Flush removes every cached entry.
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+// get returns the cached entry for key, or calls lookup once for all concurrent callers and caches its result.
+func (c *Cache) get(ctx context.Context, key string, lookup func() (*cacheEntry, error)) (*cacheEntry, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			if entry.err != nil {
+				c.stats.NegativeHits++
+			} else {
+				c.stats.Hits++
+			}
+			c.mu.Unlock()
+			return entry, entry.err
+		}
+		c.remove(elem)
+	}
+
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.entry, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	entry, err := lookup()
+	if err != nil && isDNSNotFound(err) {
+		entry = &cacheEntry{err: err, expires: time.Now().Add(c.opts.NegativeTTL)}
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if entry != nil {
+		entry.key = key
+		c.add(entry)
+	}
+	c.mu.Unlock()
+
+	call.entry, call.err = entry, err
+	close(call.done)
+	return entry, err
+}
+
+// add stores entry, evicting the least recently used entries if the cache is full. c.mu must be held.
+func (c *Cache) add(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// recordsExpiry returns the expiry time of a set of n records whose lowest TTL is ttl.
+// Empty sets have no TTL and are kept for NegativeTTL, like names that do not exist.
+func (c *Cache) recordsExpiry(n int, ttl uint32) time.Time {
+	if n == 0 {
+		return time.Now().Add(c.opts.NegativeTTL)
+	}
+	return c.expiry(ttl)
+}
+
+// expiry returns the expiry time of a record set with the given TTL in seconds.
+func (c *Cache) expiry(ttl uint32) time.Time {
+	d := time.Duration(ttl) * time.Second
+	if d < c.opts.MinTTL {
+		d = c.opts.MinTTL
+	}
+	if d > c.opts.MaxTTL {
+		d = c.opts.MaxTTL
+	}
+	return time.Now().Add(d)
+}
+
+// SystemResolver adapts a *net.Resolver so that it can be wrapped by a Cache. The system resolver
+// does not report TTLs, so every record is given ttl. If r is nil, net.DefaultResolver is used.
+func SystemResolver(r *net.Resolver, ttl time.Duration) LookupResolver {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return &systemResolver{resolver: r, ttl: uint32(ttl / time.Second)}
+}
+
+type systemResolver struct {
+	resolver *net.Resolver
+	ttl      uint32
+}
+
+func (s *systemResolver) LookupIP(ctx context.Context, host string) ([]IPRecord, error) {
+	addrs, err := s.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]IPRecord, len(addrs))
+	for i, addr := range addrs {
+		records[i] = IPRecord{IP: addr.IP, TTL: s.ttl}
+	}
+	return records, nil
+}
+
+func (s *systemResolver) LookupPTR(ctx context.Context, ip string) ([]Record, error) {
+	owner, err := ReverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, len(names))
+	for i, name := range names {
+		records[i] = Record{Name: normalizeName(owner), Type: "PTR", TTL: s.ttl}
+		records[i].setTarget(fqdn(name))
+	}
+	return records, nil
+}
+
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func remainingTTL(expires time.Time) uint32 {
+	d := time.Until(expires)
+	if d <= 0 {
+		return 0
+	}
+	return uint32((d + time.Second - 1) / time.Second)
+}
+
+func minUint32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (o CacheOptions) withDefaults() CacheOptions {
+	def := DefaultCacheOptions()
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = def.MaxEntries
+	}
+	if o.MaxTTL <= 0 {
+		o.MaxTTL = def.MaxTTL
+	}
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = def.NegativeTTL
+	}
+	return o
+}
@@ -0,0 +1,222 @@
+package domainutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// countingResolver answers from fixed data and counts the lookups it receives.
+type countingResolver struct {
+	ips   map[string][]IPRecord
+	ptrs  map[string][]Record
+	calls int32
+	delay time.Duration
+	err   error
+}
+
+func (r *countingResolver) LookupIP(ctx context.Context, host string) ([]IPRecord, error) {
+	atomic.AddInt32(&r.calls, 1)
+	time.Sleep(r.delay)
+	if r.err != nil {
+		return nil, r.err
+	}
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func (r *countingResolver) LookupPTR(ctx context.Context, ip string) ([]Record, error) {
+	atomic.AddInt32(&r.calls, 1)
+	ptrs, ok := r.ptrs[ip]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: ip, IsNotFound: true}
+	}
+	return ptrs, nil
+}
+
+func TestCache(t *testing.T) {
+	backend := &countingResolver{
+		ips: map[string][]IPRecord{
+			"example.com": {{IP: net.ParseIP("192.0.2.1"), TTL: 300}, {IP: net.ParseIP("192.0.2.2"), TTL: 60}},
+		},
+		ptrs: map[string][]Record{
+			"192.0.2.1": {{Name: "1.2.0.192.in-addr.arpa", Type: "PTR", TTL: 300, Target: "example.com", Data: "example.com."}},
+		},
+	}
+	cache := NewCache(backend, CacheOptions{})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		ips, err := cache.LookupIP(ctx, "Example.com.")
+		if err != nil {
+			t.Fatalf("LookupIP failed: %v", err)
+		}
+		if len(ips) != 2 || ips[1].TTL > 60 {
+			t.Errorf("LookupIP = %v; want 2 records with TTLs capped by the cache", ips)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.LookupIP(ctx, "missing.example.com"); !isNotFound(err) {
+			t.Errorf("Expected not found error, got %v", err)
+		}
+	}
+	names, err := cache.LookupAddr(ctx, "192.0.2.1")
+	if err != nil || len(names) != 1 || names[0] != "example.com." {
+		t.Errorf("LookupAddr = %v, %v; want [example.com.]", names, err)
+	}
+	if _, err := cache.LookupIP(ctx, "192.0.2.9"); err != nil {
+		t.Errorf("LookupIP of an IP address failed: %v", err)
+	}
+
+	if calls := atomic.LoadInt32(&backend.calls); calls != 3 {
+		t.Errorf("Expected 3 lookups to reach the resolver, got %d", calls)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.NegativeHits != 1 || stats.Misses != 3 || stats.Entries != 3 {
+		t.Errorf("Stats() = %+v; want 2 hits, 1 negative hit, 3 misses and 3 entries", stats)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	backend := &countingResolver{ips: map[string][]IPRecord{"example.com": {{IP: net.ParseIP("192.0.2.1"), TTL: 0}}}}
+	cache := NewCache(backend, CacheOptions{MaxTTL: 50 * time.Millisecond, NegativeTTL: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	cache.LookupIP(ctx, "example.com")
+	cache.LookupIP(ctx, "missing.example.com")
+	time.Sleep(60 * time.Millisecond)
+	cache.LookupIP(ctx, "example.com")
+	cache.LookupIP(ctx, "missing.example.com")
+
+	if calls := atomic.LoadInt32(&backend.calls); calls != 4 {
+		t.Errorf("Expected expired entries to be looked up again, got %d lookups", calls)
+	}
+}
+
+func TestCacheEmptyAnswer(t *testing.T) {
+	backend := &countingResolver{ptrs: map[string][]Record{"192.0.2.5": {}}}
+	cache := NewCache(backend, CacheOptions{MaxTTL: time.Hour, NegativeTTL: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	cache.LookupPTR(ctx, "192.0.2.5")
+	cache.LookupPTR(ctx, "192.0.2.5")
+	time.Sleep(60 * time.Millisecond)
+	cache.LookupPTR(ctx, "192.0.2.5")
+
+	if calls := atomic.LoadInt32(&backend.calls); calls != 2 {
+		t.Errorf("Expected an empty answer to be cached for NegativeTTL, got %d lookups", calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	backend := &countingResolver{ips: map[string][]IPRecord{
+		"a.example.com": {{IP: net.ParseIP("192.0.2.1"), TTL: 300}},
+		"b.example.com": {{IP: net.ParseIP("192.0.2.2"), TTL: 300}},
+		"c.example.com": {{IP: net.ParseIP("192.0.2.3"), TTL: 300}},
+	}}
+	cache := NewCache(backend, CacheOptions{MaxEntries: 2})
+	ctx := context.Background()
+
+	cache.LookupIP(ctx, "a.example.com")
+	cache.LookupIP(ctx, "b.example.com")
+	cache.LookupIP(ctx, "a.example.com") // a becomes the most recently used entry
+	cache.LookupIP(ctx, "c.example.com") // evicts b
+	cache.LookupIP(ctx, "a.example.com")
+	cache.LookupIP(ctx, "b.example.com")
+
+	if calls := atomic.LoadInt32(&backend.calls); calls != 4 {
+		t.Errorf("Expected 4 lookups, got %d", calls)
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 2 {
+		t.Errorf("Stats() = %+v; want 2 entries and 2 evictions", stats)
+	}
+}
+
+func TestCacheConcurrentLookups(t *testing.T) {
+	backend := &countingResolver{
+		ips:   map[string][]IPRecord{"example.com": {{IP: net.ParseIP("192.0.2.1"), TTL: 300}}},
+		delay: 50 * time.Millisecond,
+	}
+	cache := NewCache(backend, CacheOptions{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.LookupIP(context.Background(), "example.com"); err != nil {
+				t.Errorf("LookupIP failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&backend.calls); calls != 1 {
+		t.Errorf("Expected concurrent lookups to share one query, got %d", calls)
+	}
+}
+
+func TestCacheTemporaryFailure(t *testing.T) {
+	backend := &countingResolver{err: errors.New("timeout")}
+	cache := NewCache(backend, CacheOptions{})
+
+	cache.LookupIP(context.Background(), "example.com")
+	cache.LookupIP(context.Background(), "example.com")
+	if calls := atomic.LoadInt32(&backend.calls); calls != 2 {
+		t.Errorf("Expected temporary failures not to be cached, got %d lookups", calls)
+	}
+}
+
+func TestCacheDialContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	backend := &countingResolver{ips: map[string][]IPRecord{"app.test": {{IP: net.ParseIP("127.0.0.1"), TTL: 300}}}}
+	cache := NewCache(backend, CacheOptions{})
+
+	conn, err := cache.DialContext(context.Background(), "tcp", net.JoinHostPort("app.test", port))
+	if err != nil {
+		t.Fatalf("DialContext failed: %v", err)
+	}
+	conn.Close()
+
+	if _, err := cache.DialContext(context.Background(), "tcp6", net.JoinHostPort("app.test", port)); err == nil {
+		t.Errorf("Expected error when no address matches the network")
+	}
+}
+
+func TestCacheWithResolver(t *testing.T) {
+	var queries int32
+	addr := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		atomic.AddInt32(&queries, 1)
+		return exampleHandler(q, tcp)
+	})
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	cache := NewCache(r, CacheOptions{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.LookupIP(context.Background(), "www.example.com"); err != nil {
+			t.Fatalf("LookupIP failed: %v", err)
+		}
+	}
+	// One A and one AAAA query.
+	if n := atomic.LoadInt32(&queries); n != 2 {
+		t.Errorf("Expected 2 queries, got %d", n)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"net"
 	"net/url"
 	"regexp"
-	"strings"
 	"time"
 )
 
@@ -75,14 +74,18 @@ func IsValidDomain(domain string) bool {
 	return u.Host != "" && u.Path == "" && u.RawQuery == ""
 }
 
-// GetRootDomain returns the root domain of a domain
+// GetRootDomain returns the root domain (eTLD+1) of a domain, based on the Public Suffix List.
+// It returns an empty string if the domain has no registrable part, e.g. "co.uk", or is an IP address.
 func GetRootDomain(domain string) string {
-	r, _ := regexp.Compile(`\w+\.\w+$`)
-	m := r.FindString(domain)
-	return strings.ToLower(m)
+	root, err := RegistrableDomain(domain)
+	if err != nil {
+		return ""
+	}
+	return root
 }
 
-// GetRootDomains returns a list of unique root domains for a slice of domains
+// GetRootDomains returns a list of unique root domains for a slice of domains,
+// in the order they first appear
 func GetRootDomains(items []string) (rootDomains []string) {
 	for _, item := range items {
 		root := GetRootDomain(item)
@@ -91,13 +94,14 @@ func GetRootDomains(items []string) (rootDomains []string) {
 	return unique(rootDomains)
 }
 
+// unique removes duplicates from items, keeping the first occurrence of each.
 func unique(items []string) (uniqueItems []string) {
 	uniqueMap := make(map[string]bool)
 	for _, item := range items {
-		uniqueMap[item] = true
-	}
-	for item := range uniqueMap {
-		uniqueItems = append(uniqueItems, item)
+		if !uniqueMap[item] {
+			uniqueMap[item] = true
+			uniqueItems = append(uniqueItems, item)
+		}
 	}
 	return
 }
@@ -1,6 +1,7 @@
 package domainutil
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -35,8 +36,14 @@ func TestGetRootDomain(t *testing.T) {
 		{"example.com", "example.com"},
 		{"sub.example.com", "example.com"},
 		{"sub.sub.example.com", "example.com"},
-		{"example.co.uk", "co.uk"},
-		{"sub.example.co.uk", "co.uk"},
+		{"example.co.uk", "example.co.uk"},
+		{"shop.example.co.uk", "example.co.uk"},
+		{"Sub.Example.COM", "example.com"},
+		{"*.example.com", "example.com"},
+		{"co.uk", ""},
+		{"localhost", ""},
+		{"192.0.2.1", ""},
+		{"2001:db8::1", ""},
 	}
 
 	for _, test := range tests {
@@ -45,3 +52,11 @@ func TestGetRootDomain(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRootDomains(t *testing.T) {
+	roots := GetRootDomains([]string{"shop.example.co.uk", "mail.other.co.uk", "example.co.uk"})
+	want := []string{"example.co.uk", "other.co.uk"}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("GetRootDomains returned %v; want %v", roots, want)
+	}
+}
@@ -0,0 +1,282 @@
+package domainutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// massdnsResponse is a line of massdns ndjson output (-o J).
+type massdnsResponse struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Data   struct {
+		Answers     []massdnsRecord `json:"answers"`
+		Authorities []massdnsRecord `json:"authorities"`
+		Additionals []massdnsRecord `json:"additionals"`
+	} `json:"data"`
+}
+
+type massdnsRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// dnsxResponse is a line of dnsx JSON output (-json).
+type dnsxResponse struct {
+	Host       string            `json:"host"`
+	TTL        uint32            `json:"ttl"`
+	StatusCode string            `json:"status_code"`
+	A          []string          `json:"a"`
+	AAAA       []string          `json:"aaaa"`
+	CNAME      []string          `json:"cname"`
+	NS         []string          `json:"ns"`
+	MX         []string          `json:"mx"`
+	PTR        []string          `json:"ptr"`
+	TXT        []string          `json:"txt"`
+	SRV        []string          `json:"srv"`
+	CAA        []string          `json:"caa"`
+	SOA        []json.RawMessage `json:"soa"`
+}
+
+// dnsxSOA is the object form of a dnsx SOA record.
+type dnsxSOA struct {
+	NS      string `json:"ns"`
+	Mailbox string `json:"mailbox"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	MinTTL  uint32 `json:"minttl"`
+}
+
+// ParseMassDNS parses massdns output in the ndjson (-o J) or simple text (-o S) format.
+// Each JSON line becomes one Response. In the simple format, which has no TTLs or response codes,
+// consecutive lines with the same owner name and type are grouped into a Response.
+func ParseMassDNS(r io.Reader) ([]Response, error) {
+	var responses []Response
+	err := scanLines(r, func(line string) error {
+		if strings.HasPrefix(line, "{") {
+			var m massdnsResponse
+			if err := json.Unmarshal([]byte(line), &m); err != nil {
+				return err
+			}
+			resp := Response{Name: normalizeName(m.Name), Type: strings.ToUpper(m.Type), RCode: strings.ToUpper(m.Status)}
+			var err error
+			if resp.Answers, err = massdnsRecords(m.Data.Answers); err != nil {
+				return err
+			}
+			if resp.Authority, err = massdnsRecords(m.Data.Authorities); err != nil {
+				return err
+			}
+			if resp.Additional, err = massdnsRecords(m.Data.Additionals); err != nil {
+				return err
+			}
+			responses = append(responses, resp)
+			return nil
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid massdns line %q", line)
+		}
+		rec, err := NewRecord(fields[0], fields[1], 0, fields[2])
+		if err != nil {
+			return err
+		}
+		if n := len(responses); n > 0 && responses[n-1].Name == rec.Name && responses[n-1].Type == rec.Type {
+			responses[n-1].Answers = append(responses[n-1].Answers, rec)
+			return nil
+		}
+		responses = append(responses, Response{Name: rec.Name, Type: rec.Type, RCode: "NOERROR", Answers: []Record{rec}})
+		return nil
+	})
+	return responses, err
+}
+
+func massdnsRecords(in []massdnsRecord) ([]Record, error) {
+	var records []Record
+	for _, m := range in {
+		if strings.EqualFold(m.Type, "OPT") {
+			continue
+		}
+		rec, err := NewRecord(m.Name, m.Type, m.TTL, m.Data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// ParseDNSX parses dnsx JSON output (-json), one Response per line. dnsx reports a single TTL per host,
+// which is used for every record, and MX records without their preference, which is set to 0.
+// Addresses of a host with a CNAME are owned by the last name of the chain, as in a lookup.
+func ParseDNSX(r io.Reader) ([]Response, error) {
+	var responses []Response
+	err := scanLines(r, func(line string) error {
+		var d dnsxResponse
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			return err
+		}
+		host := normalizeName(d.Host)
+		resp := Response{Name: host, RCode: strings.ToUpper(d.StatusCode)}
+		if resp.RCode == "" {
+			resp.RCode = "NOERROR"
+		}
+
+		add := func(owner, rtype, data string) error {
+			rec, err := NewRecord(owner, rtype, d.TTL, data)
+			if err != nil {
+				return err
+			}
+			resp.Answers = append(resp.Answers, rec)
+			return nil
+		}
+
+		owner := host
+		for _, target := range d.CNAME {
+			if err := add(owner, "CNAME", target); err != nil {
+				return err
+			}
+			owner = target
+		}
+		for _, list := range []struct {
+			rtype  string
+			values []string
+		}{{"A", d.A}, {"AAAA", d.AAAA}} {
+			for _, v := range list.values {
+				if err := add(owner, list.rtype, v); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, list := range []struct {
+			rtype  string
+			values []string
+		}{{"NS", d.NS}, {"PTR", d.PTR}, {"SRV", d.SRV}, {"CAA", d.CAA}} {
+			for _, v := range list.values {
+				if err := add(host, list.rtype, v); err != nil {
+					return err
+				}
+			}
+		}
+		for _, v := range d.MX {
+			if !strings.Contains(v, " ") {
+				v = "0 " + v
+			}
+			if err := add(host, "MX", v); err != nil {
+				return err
+			}
+		}
+		for _, v := range d.TXT {
+			if err := add(host, "TXT", quoteString(v)); err != nil {
+				return err
+			}
+		}
+		for _, raw := range d.SOA {
+			data, err := dnsxSOAData(raw)
+			if err != nil {
+				return err
+			}
+			if err := add(host, "SOA", data); err != nil {
+				return err
+			}
+		}
+
+		responses = append(responses, resp)
+		return nil
+	})
+	return responses, err
+}
+
+// dnsxSOAData returns the presentation format of a dnsx SOA record, which older
+// versions report as a string and newer ones as an object.
+func dnsxSOAData(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var soa dnsxSOA
+	if err := json.Unmarshal(raw, &soa); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %d %d %d %d %d", fqdn(soa.NS), fqdn(soa.Mailbox),
+		soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.MinTTL), nil
+}
+
+// MergeRecords combines record sets, dropping duplicates. Records are duplicates if they
+// have the same name, type and data; the first one seen is kept, in input order.
+func MergeRecords(sets ...[]Record) []Record {
+	seen := make(map[string]bool)
+	var merged []Record
+	for _, set := range sets {
+		for _, rec := range set {
+			key := recordKey(rec)
+			if !seen[key] {
+				seen[key] = true
+				merged = append(merged, rec)
+			}
+		}
+	}
+	return merged
+}
+
+// DiffRecords compares two record sets, ignoring TTLs, and returns the records
+// only found in newer and those only found in older.
+func DiffRecords(older, newer []Record) (added, removed []Record) {
+	inOlder := make(map[string]bool, len(older))
+	for _, rec := range older {
+		inOlder[recordKey(rec)] = true
+	}
+	inNewer := make(map[string]bool, len(newer))
+	for _, rec := range newer {
+		inNewer[recordKey(rec)] = true
+	}
+
+	for _, rec := range MergeRecords(newer) {
+		if !inOlder[recordKey(rec)] {
+			added = append(added, rec)
+		}
+	}
+	for _, rec := range MergeRecords(older) {
+		if !inNewer[recordKey(rec)] {
+			removed = append(removed, rec)
+		}
+	}
+	return added, removed
+}
+
+// recordKey identifies a record by name, type and data. Names in data are compared case-insensitively.
+func recordKey(rec Record) string {
+	data := rec.Data
+	if rec.Text == nil && rec.CAA == nil {
+		data = strings.ToLower(data)
+	}
+	return rec.Name + "\x00" + rec.Type + "\x00" + data
+}
+
+// scanLines calls fn for every non-empty line of r, prefixing errors with the line number.
+func scanLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := string(bytes.TrimSpace(scanner.Bytes()))
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,111 @@
+package domainutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMassDNS(t *testing.T) {
+	input := `{"name":"www.example.com.","type":"A","class":"IN","status":"NOERROR","rx_ts":1700000000000000000,"data":{"answers":[{"ttl":300,"type":"CNAME","class":"IN","name":"www.example.com.","data":"example.com."},{"ttl":60,"type":"A","class":"IN","name":"example.com.","data":"192.0.2.1"}]},"flags":["rd","ra"],"resolver":"8.8.8.8:53","proto":"UDP"}
+{"name":"missing.example.com.","type":"A","class":"IN","status":"NXDOMAIN","data":{"authorities":[{"ttl":900,"type":"SOA","class":"IN","name":"example.com.","data":"ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 300"}]}}
+
+example.com. MX 10 mail.example.com.
+example.com. MX 20 backup.example.com.
+example.com. TXT "v=spf1 -all"
+`
+
+	responses, err := ParseMassDNS(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseMassDNS failed: %v", err)
+	}
+	if len(responses) != 4 {
+		t.Fatalf("ParseMassDNS returned %d responses; want 4", len(responses))
+	}
+
+	if resp := responses[0]; resp.Name != "www.example.com" || resp.RCode != "NOERROR" || len(resp.Answers) != 2 ||
+		resp.Answers[0].Target != "example.com" || resp.Answers[1].IP.String() != "192.0.2.1" || resp.Answers[1].TTL != 60 {
+		t.Errorf("Unexpected first response %+v", resp)
+	}
+	if resp := responses[1]; resp.RCode != "NXDOMAIN" || len(resp.Authority) != 1 || resp.Authority[0].SOA == nil {
+		t.Errorf("Unexpected NXDOMAIN response %+v", resp)
+	}
+	if resp := responses[2]; resp.Type != "MX" || len(resp.Answers) != 2 || resp.Answers[1].Target != "backup.example.com" {
+		t.Errorf("Unexpected MX response %+v", resp)
+	}
+	if resp := responses[3]; resp.Type != "TXT" || len(resp.Answers) != 1 || resp.Answers[0].Text[0] != "v=spf1 -all" {
+		t.Errorf("Unexpected TXT response %+v", resp)
+	}
+
+	if _, err := ParseMassDNS(strings.NewReader("example.com. A not-an-ip\n")); err == nil {
+		t.Errorf("Expected error for invalid record")
+	}
+}
+
+func TestParseDNSX(t *testing.T) {
+	input := `{"host":"www.example.com","ttl":300,"resolver":["8.8.8.8:53"],"a":["192.0.2.1","192.0.2.2"],"cname":["example.net"],"status_code":"NOERROR","timestamp":"2024-01-01T00:00:00Z"}
+{"host":"example.com","ttl":3600,"ns":["ns1.example.com"],"mx":["mail.example.com"],"txt":["v=spf1 -all"],"soa":[{"name":"example.com","ns":"ns1.example.com","mailbox":"hostmaster.example.com","serial":42,"refresh":7200,"retry":900,"expire":1209600,"minttl":300}],"status_code":"NOERROR"}
+{"host":"missing.example.com","status_code":"NXDOMAIN"}
+`
+
+	responses, err := ParseDNSX(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDNSX failed: %v", err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("ParseDNSX returned %d responses; want 3", len(responses))
+	}
+
+	www := responses[0].Answers
+	if len(www) != 3 || www[0].Type != "CNAME" || www[0].Name != "www.example.com" || www[1].Name != "example.net" || www[2].Data != "192.0.2.2" {
+		t.Errorf("Unexpected www answers %v", www)
+	}
+
+	var types []string
+	for _, rec := range responses[1].Answers {
+		types = append(types, rec.Type)
+	}
+	if strings.Join(types, ",") != "NS,MX,TXT,SOA" {
+		t.Errorf("Unexpected record types %v", types)
+	}
+	if soa := responses[1].Answers[3].SOA; soa == nil || soa.Serial != 42 || soa.MBox != "hostmaster.example.com" {
+		t.Errorf("Unexpected SOA %+v", soa)
+	}
+	if responses[2].RCode != "NXDOMAIN" || len(responses[2].Answers) != 0 {
+		t.Errorf("Unexpected NXDOMAIN response %+v", responses[2])
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	older, err := ParseZone(strings.NewReader(`$TTL 300
+www.example.com. A 192.0.2.1
+www.example.com. A 192.0.2.2
+mail.example.com. MX 10 MX.example.com.
+`), "")
+	if err != nil {
+		t.Fatalf("ParseZone failed: %v", err)
+	}
+
+	newer, err := ParseMassDNS(strings.NewReader(`www.example.com. A 192.0.2.1
+www.example.com. A 192.0.2.3
+mail.example.com. MX 10 mx.example.com.
+`))
+	if err != nil {
+		t.Fatalf("ParseMassDNS failed: %v", err)
+	}
+	var current []Record
+	for _, resp := range newer {
+		current = append(current, resp.Answers...)
+	}
+
+	added, removed := DiffRecords(older, current)
+	if len(added) != 1 || added[0].Data != "192.0.2.3" {
+		t.Errorf("DiffRecords added = %v; want 192.0.2.3", added)
+	}
+	if len(removed) != 1 || removed[0].Data != "192.0.2.2" {
+		t.Errorf("DiffRecords removed = %v; want 192.0.2.2", removed)
+	}
+
+	if merged := MergeRecords(older, current); len(merged) != 4 {
+		t.Errorf("MergeRecords returned %d records; want 4: %v", len(merged), merged)
+	}
+}
@@ -0,0 +1,647 @@
+package domainutil
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxSPFLookups is the number of DNS lookups an SPF evaluation may cause (RFC 7208, section 4.6.4).
+const maxSPFLookups = 10
+
+// maxSPFDepth bounds how deep include and redirect chains are followed.
+const maxSPFDepth = 10
+
+// Severity ranks a MailIssue.
+type Severity string
+
+// Issue severities.
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+// SPFRecord is a parsed SPF policy (RFC 7208).
+type SPFRecord struct {
+	Domain      string         `json:"domain"`
+	Raw         string         `json:"raw"`
+	Mechanisms  []SPFMechanism `json:"mechanisms"`
+	Redirect    string         `json:"redirect,omitempty"`
+	Explanation string         `json:"exp,omitempty"`
+
+	// Set by LookupSPF.
+	RedirectRecord *SPFRecord `json:"redirect_record,omitempty"`
+	RedirectError  string     `json:"redirect_error,omitempty"`
+	Lookups        int        `json:"lookups"` // DNS lookups caused by this record, including nested records that were followed
+}
+
+// SPFMechanism is a single mechanism of an SPF record, e.g. "-all" or "include:_spf.example.com".
+type SPFMechanism struct {
+	Qualifier string `json:"qualifier"`       // "+", "-", "~" or "?"
+	Name      string `json:"name"`            // all, include, a, mx, ptr, ip4, ip6 or exists
+	Value     string `json:"value,omitempty"` // domain or network, including any CIDR length
+
+	// Set by LookupSPF for include mechanisms.
+	Record *SPFRecord `json:"record,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// DMARCRecord is a parsed DMARC policy (RFC 7489).
+type DMARCRecord struct {
+	Domain          string            `json:"domain"` // domain the record was found at, e.g. the organizational domain
+	Raw             string            `json:"raw"`
+	Policy          string            `json:"p"`
+	SubdomainPolicy string            `json:"sp,omitempty"`
+	Percent         int               `json:"pct"`
+	RUA             []string          `json:"rua,omitempty"`
+	RUF             []string          `json:"ruf,omitempty"`
+	ADKIM           string            `json:"adkim"` // "r" or "s"
+	ASPF            string            `json:"aspf"`  // "r" or "s"
+	Tags            map[string]string `json:"tags"`
+}
+
+// DKIMRecord is a parsed DKIM public key record (RFC 6376).
+type DKIMRecord struct {
+	Selector  string            `json:"selector"`
+	Domain    string            `json:"domain"`
+	Raw       string            `json:"raw"`
+	KeyType   string            `json:"k"`
+	PublicKey string            `json:"p,omitempty"`
+	KeyBits   int               `json:"key_bits,omitempty"` // RSA key size, 0 if unknown
+	Revoked   bool              `json:"revoked"`            // the public key is empty
+	Testing   bool              `json:"testing"`            // the "y" flag is set
+	Tags      map[string]string `json:"tags"`
+}
+
+// MailIssue is a misconfiguration found by AuditMail.
+type MailIssue struct {
+	Severity Severity `json:"severity"`
+	Record   string   `json:"record"` // "SPF", "DMARC" or "DKIM"
+	Message  string   `json:"message"`
+}
+
+// MailReport is the outcome of AuditMail.
+type MailReport struct {
+	Domain string       `json:"domain"`
+	SPF    *SPFRecord   `json:"spf,omitempty"`
+	DMARC  *DMARCRecord `json:"dmarc,omitempty"`
+	DKIM   []DKIMRecord `json:"dkim,omitempty"`
+	Issues []MailIssue  `json:"issues"`
+}
+
+// AuditMail fetches the SPF and DMARC records of domain and the DKIM records of the given
+// selectors, and reports misconfigurations such as "+all", a missing DMARC policy or an SPF
+// policy requiring more than 10 DNS lookups. DNS failures other than missing records are returned as errors.
+func (r *Resolver) AuditMail(ctx context.Context, domain string, selectors []string) (*MailReport, error) {
+	report := &MailReport{Domain: normalizeName(domain)}
+	issue := func(severity Severity, record, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, MailIssue{Severity: severity, Record: record, Message: fmt.Sprintf(format, args...)})
+	}
+
+	spf, err := r.LookupSPF(ctx, domain)
+	switch {
+	case err == nil:
+		report.SPF = spf
+		report.Issues = append(report.Issues, spf.Issues()...)
+	case isDNSNotFound(err):
+		issue(SeverityMedium, "SPF", "no SPF record found")
+	case isLookupError(ctx, err):
+		return nil, err
+	default:
+		issue(SeverityHigh, "SPF", "%v", err)
+	}
+
+	dmarc, err := r.LookupDMARC(ctx, domain)
+	switch {
+	case err == nil:
+		report.DMARC = dmarc
+		report.Issues = append(report.Issues, dmarc.Issues()...)
+	case isDNSNotFound(err):
+		issue(SeverityHigh, "DMARC", "no DMARC record found")
+	case isLookupError(ctx, err):
+		return nil, err
+	default:
+		issue(SeverityHigh, "DMARC", "%v", err)
+	}
+
+	for _, selector := range selectors {
+		dkim, err := r.LookupDKIM(ctx, selector, domain)
+		switch {
+		case err == nil:
+			report.DKIM = append(report.DKIM, *dkim)
+			report.Issues = append(report.Issues, dkim.Issues()...)
+		case isDNSNotFound(err):
+			issue(SeverityMedium, "DKIM", "no DKIM record found for selector %q", selector)
+		case isLookupError(ctx, err):
+			return nil, err
+		default:
+			issue(SeverityHigh, "DKIM", "selector %q: %v", selector, err)
+		}
+	}
+
+	return report, nil
+}
+
+// LookupSPF fetches and parses the SPF record of domain, following include mechanisms and
+// the redirect modifier. Records included more than once are fetched once, and no more records
+// are followed once the limit of 10 DNS lookups is exceeded. Failures of nested records are
+// reported in the Error fields rather than returned. A missing record is reported as a
+// *net.DNSError with IsNotFound set.
+func (r *Resolver) LookupSPF(ctx context.Context, domain string) (*SPFRecord, error) {
+	w := &spfWalk{path: make(map[string]bool), done: make(map[string]spfResult)}
+	return r.lookupSPF(ctx, normalizeName(domain), w, 0)
+}
+
+// spfWalk is the state shared by the nested lookups of a single LookupSPF call.
+type spfWalk struct {
+	path    map[string]bool      // records being resolved, to detect loops
+	done    map[string]spfResult // records already resolved
+	lookups int                  // DNS lookups counted so far across all records
+}
+
+type spfResult struct {
+	record *SPFRecord
+	err    string
+}
+
+func (r *Resolver) lookupSPF(ctx context.Context, domain string, w *spfWalk, depth int) (*SPFRecord, error) {
+	raw, err := r.lookupPolicy(ctx, domain, "SPF", isSPF)
+	if err != nil {
+		return nil, err
+	}
+	spf, err := ParseSPF(raw)
+	if err != nil {
+		return nil, err
+	}
+	spf.Domain = domain
+	spf.Lookups = spf.ownLookups()
+	w.lookups += spf.Lookups
+
+	w.path[domain] = true
+	defer delete(w.path, domain)
+
+	resolve := func(target string) (*SPFRecord, string) {
+		target = normalizeName(target)
+		switch {
+		case w.path[target]:
+			return nil, "include loop via " + target
+		case depth+1 >= maxSPFDepth:
+			return nil, "too many nested records"
+		case strings.Contains(target, "%"):
+			// Macros are expanded at evaluation time and cannot be followed statically.
+			return nil, ""
+		case w.lookups > maxSPFLookups:
+			return nil, fmt.Sprintf("not followed, the limit of %d DNS lookups is exceeded", maxSPFLookups)
+		}
+		if res, ok := w.done[target]; ok {
+			if res.record != nil {
+				w.lookups += res.record.Lookups
+			}
+			return res.record, res.err
+		}
+		nested, err := r.lookupSPF(ctx, target, w, depth+1)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err().Error()
+			}
+			w.done[target] = spfResult{err: err.Error()}
+			return nil, err.Error()
+		}
+		w.done[target] = spfResult{record: nested}
+		return nested, ""
+	}
+
+	for i := range spf.Mechanisms {
+		m := &spf.Mechanisms[i]
+		if m.Name != "include" {
+			continue
+		}
+		m.Record, m.Error = resolve(m.Value)
+		if m.Record != nil {
+			spf.Lookups += m.Record.Lookups
+		}
+	}
+	if spf.Redirect != "" && !spf.hasAll() {
+		spf.RedirectRecord, spf.RedirectError = resolve(spf.Redirect)
+		if spf.RedirectRecord != nil {
+			spf.Lookups += spf.RedirectRecord.Lookups
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return spf, nil
+}
+
+// LookupDMARC fetches and parses the DMARC record of domain. If domain has none, the record of
+// its organizational domain is used, as receivers do. A missing record is reported as a
+// *net.DNSError with IsNotFound set.
+func (r *Resolver) LookupDMARC(ctx context.Context, domain string) (*DMARCRecord, error) {
+	domain = normalizeName(domain)
+	candidates := []string{domain}
+	if org, err := RegistrableDomain(domain); err == nil && org != domain {
+		candidates = append(candidates, org)
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		raw, err := r.lookupPolicy(ctx, "_dmarc."+candidate, "DMARC", isDMARC)
+		if err != nil {
+			if isDNSNotFound(err) {
+				lastErr = err
+				continue
+			}
+			return nil, err
+		}
+		dmarc, err := ParseDMARC(raw)
+		if err != nil {
+			return nil, err
+		}
+		dmarc.Domain = candidate
+		return dmarc, nil
+	}
+	return nil, lastErr
+}
+
+// LookupDKIM fetches and parses the DKIM key record of a selector. A missing record is
+// reported as a *net.DNSError with IsNotFound set.
+func (r *Resolver) LookupDKIM(ctx context.Context, selector, domain string) (*DKIMRecord, error) {
+	domain = normalizeName(domain)
+	raw, err := r.lookupPolicy(ctx, selector+"._domainkey."+domain, "DKIM", isDKIM)
+	if err != nil {
+		return nil, err
+	}
+	dkim, err := ParseDKIM(raw)
+	if err != nil {
+		return nil, err
+	}
+	dkim.Selector = selector
+	dkim.Domain = domain
+	return dkim, nil
+}
+
+// lookupPolicy returns the single TXT record of name accepted by match.
+func (r *Resolver) lookupPolicy(ctx context.Context, name, kind string, match func(string) bool) (string, error) {
+	records, err := r.LookupTXT(ctx, name)
+	if err != nil && !isDNSNotFound(err) {
+		return "", err
+	}
+
+	var found []string
+	for _, rec := range records {
+		if txt := strings.Join(rec.Text, ""); match(txt) {
+			found = append(found, txt)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", &net.DNSError{Err: "no " + kind + " record found", Name: name, IsNotFound: true}
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%d %s records found at %s, only one is allowed", len(found), kind, name)
+}
+
+// ParseSPF parses an SPF record such as "v=spf1 include:_spf.example.com -all".
+func ParseSPF(raw string) (*SPFRecord, error) {
+	if !isSPF(raw) {
+		return nil, fmt.Errorf("not an SPF record: %q", raw)
+	}
+
+	spf := &SPFRecord{Raw: raw}
+	for _, term := range strings.Fields(raw)[1:] {
+		// Modifiers are name=value, where the name cannot contain ':' or '/'.
+		if i := strings.IndexByte(term, '='); i > 0 && !strings.ContainsAny(term[:i], ":/") {
+			name, value := strings.ToLower(term[:i]), term[i+1:]
+			switch name {
+			case "redirect":
+				if spf.Redirect != "" {
+					return nil, errors.New("duplicate redirect modifier")
+				}
+				spf.Redirect = value
+			case "exp":
+				spf.Explanation = value
+			}
+			continue
+		}
+
+		m := SPFMechanism{Qualifier: "+"}
+		if strings.ContainsRune("+-~?", rune(term[0])) {
+			m.Qualifier, term = term[:1], term[1:]
+		}
+		m.Name = term
+		if i := strings.IndexAny(term, ":/"); i >= 0 {
+			m.Name, m.Value = term[:i], strings.TrimPrefix(term[i:], ":")
+		}
+		m.Name = strings.ToLower(m.Name)
+
+		if err := validateSPFMechanism(m); err != nil {
+			return nil, err
+		}
+		spf.Mechanisms = append(spf.Mechanisms, m)
+	}
+	return spf, nil
+}
+
+func validateSPFMechanism(m SPFMechanism) error {
+	switch m.Name {
+	case "all":
+		if m.Value != "" {
+			return errors.New("all takes no argument")
+		}
+	case "include", "exists":
+		if m.Value == "" {
+			return fmt.Errorf("%s requires a domain", m.Name)
+		}
+	case "a", "mx", "ptr":
+	case "ip4", "ip6":
+		addr, length, hasLength := strings.Cut(m.Value, "/")
+		ip := net.ParseIP(addr)
+		bits := 32
+		if m.Name == "ip6" {
+			bits = 128
+		}
+		valid := ip != nil && (m.Name == "ip4") == !strings.Contains(addr, ":")
+		if n, err := strconv.Atoi(length); hasLength && (err != nil || n < 0 || n > bits) {
+			valid = false
+		}
+		if !valid {
+			return fmt.Errorf("invalid %s network %q", m.Name, m.Value)
+		}
+	default:
+		return fmt.Errorf("unknown mechanism %q", m.Name)
+	}
+	return nil
+}
+
+// Issues reports the misconfigurations of the SPF record and its nested records.
+func (spf *SPFRecord) Issues() []MailIssue {
+	var issues []MailIssue
+	issue := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, MailIssue{Severity: severity, Record: "SPF", Message: fmt.Sprintf(format, args...)})
+	}
+
+	if spf.Lookups > maxSPFLookups {
+		issue(SeverityHigh, "SPF policy requires %d DNS lookups, more than the limit of %d", spf.Lookups, maxSPFLookups)
+	}
+
+	all := spf.effectiveAll()
+	switch {
+	case all == nil:
+		issue(SeverityLow, "SPF policy has no all mechanism, unmatched senders are neutral")
+	case all.Qualifier == "+":
+		issue(SeverityHigh, "SPF policy ends with +all and allows any sender")
+	case all.Qualifier == "?":
+		issue(SeverityMedium, "SPF policy ends with ?all and does not restrict senders")
+	}
+
+	var walk func(rec *SPFRecord)
+	walk = func(rec *SPFRecord) {
+		for _, m := range rec.Mechanisms {
+			if m.Name == "ptr" {
+				issue(SeverityLow, "%s uses the deprecated ptr mechanism", rec.Domain)
+			}
+			if m.Name == "include" && m.Error != "" {
+				issue(SeverityHigh, "%s includes %s: %s", rec.Domain, m.Value, m.Error)
+			}
+			if m.Record != nil {
+				walk(m.Record)
+			}
+		}
+		if rec.RedirectError != "" {
+			issue(SeverityHigh, "%s redirects to %s: %s", rec.Domain, rec.Redirect, rec.RedirectError)
+		}
+		if rec.RedirectRecord != nil {
+			walk(rec.RedirectRecord)
+		}
+	}
+	walk(spf)
+
+	return issues
+}
+
+// effectiveAll returns the all mechanism that applies, following redirects.
+func (spf *SPFRecord) effectiveAll() *SPFMechanism {
+	for rec := spf; rec != nil; rec = rec.RedirectRecord {
+		for i := range rec.Mechanisms {
+			if rec.Mechanisms[i].Name == "all" {
+				return &rec.Mechanisms[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (spf *SPFRecord) hasAll() bool {
+	for _, m := range spf.Mechanisms {
+		if m.Name == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// ownLookups counts the mechanisms and modifiers of the record itself that cause DNS lookups.
+func (spf *SPFRecord) ownLookups() int {
+	n := 0
+	for _, m := range spf.Mechanisms {
+		switch m.Name {
+		case "include", "a", "mx", "ptr", "exists":
+			n++
+		}
+	}
+	if spf.Redirect != "" && !spf.hasAll() {
+		n++
+	}
+	return n
+}
+
+// ParseDMARC parses a DMARC record such as "v=DMARC1; p=reject; rua=mailto:dmarc@example.com".
+func ParseDMARC(raw string) (*DMARCRecord, error) {
+	if !isDMARC(raw) {
+		return nil, fmt.Errorf("not a DMARC record: %q", raw)
+	}
+	tags := parseTags(raw)
+
+	dmarc := &DMARCRecord{
+		Raw:             raw,
+		Policy:          strings.ToLower(tags["p"]),
+		SubdomainPolicy: strings.ToLower(tags["sp"]),
+		Percent:         100,
+		ADKIM:           "r",
+		ASPF:            "r",
+		Tags:            tags,
+	}
+	switch dmarc.Policy {
+	case "none", "quarantine", "reject":
+	case "":
+		return nil, errors.New("DMARC record has no policy")
+	default:
+		return nil, fmt.Errorf("invalid DMARC policy %q", dmarc.Policy)
+	}
+	if pct, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("invalid DMARC pct %q", pct)
+		}
+		dmarc.Percent = n
+	}
+	if v := strings.ToLower(tags["adkim"]); v != "" {
+		dmarc.ADKIM = v
+	}
+	if v := strings.ToLower(tags["aspf"]); v != "" {
+		dmarc.ASPF = v
+	}
+	dmarc.RUA = splitURIs(tags["rua"])
+	dmarc.RUF = splitURIs(tags["ruf"])
+	return dmarc, nil
+}
+
+// Issues reports the weaknesses of the DMARC policy.
+func (d *DMARCRecord) Issues() []MailIssue {
+	var issues []MailIssue
+	issue := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, MailIssue{Severity: severity, Record: "DMARC", Message: fmt.Sprintf(format, args...)})
+	}
+
+	if d.Policy == "none" {
+		issue(SeverityMedium, "DMARC policy is p=none and only monitors failing mail")
+	}
+	if d.SubdomainPolicy == "none" && d.Policy != "none" {
+		issue(SeverityLow, "DMARC subdomain policy is sp=none")
+	}
+	if d.Percent < 100 {
+		issue(SeverityLow, "DMARC policy only applies to %d%% of failing mail", d.Percent)
+	}
+	if len(d.RUA) == 0 {
+		issue(SeverityLow, "DMARC record has no aggregate report address (rua)")
+	}
+	return issues
+}
+
+// ParseDKIM parses a DKIM key record such as "v=DKIM1; k=rsa; p=MIIBIjANBg...".
+func ParseDKIM(raw string) (*DKIMRecord, error) {
+	if !isDKIM(raw) {
+		return nil, fmt.Errorf("not a DKIM record: %q", raw)
+	}
+	tags := parseTags(raw)
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("DKIM record has no public key tag")
+	}
+
+	dkim := &DKIMRecord{
+		Raw:       raw,
+		KeyType:   strings.ToLower(tags["k"]),
+		PublicKey: strings.Join(strings.Fields(p), ""),
+		Tags:      tags,
+	}
+	if dkim.KeyType == "" {
+		dkim.KeyType = "rsa"
+	}
+	for _, flag := range strings.Split(tags["t"], ":") {
+		if strings.TrimSpace(flag) == "y" {
+			dkim.Testing = true
+		}
+	}
+
+	if dkim.PublicKey == "" {
+		dkim.Revoked = true
+		return dkim, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(dkim.PublicKey)
+	if err != nil {
+		return nil, errors.New("invalid DKIM public key encoding")
+	}
+	if dkim.KeyType == "rsa" {
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			// Some records carry a bare PKCS #1 key.
+			key, err = x509.ParsePKCS1PublicKey(der)
+		}
+		if err != nil {
+			return nil, errors.New("invalid DKIM RSA public key")
+		}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			dkim.KeyBits = rsaKey.N.BitLen()
+		}
+	}
+	return dkim, nil
+}
+
+// Issues reports the weaknesses of the DKIM key.
+func (d *DKIMRecord) Issues() []MailIssue {
+	var issues []MailIssue
+	issue := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, MailIssue{Severity: severity, Record: "DKIM", Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case d.Revoked:
+		issue(SeverityLow, "DKIM key for selector %q is revoked", d.Selector)
+	case d.KeyBits > 0 && d.KeyBits < 1024:
+		issue(SeverityHigh, "DKIM key for selector %q is only %d bits", d.Selector, d.KeyBits)
+	case d.KeyBits > 0 && d.KeyBits < 2048:
+		issue(SeverityLow, "DKIM key for selector %q is %d bits, 2048 are recommended", d.Selector, d.KeyBits)
+	}
+	if d.Testing {
+		issue(SeverityLow, "DKIM key for selector %q is in testing mode", d.Selector)
+	}
+	return issues
+}
+
+// isLookupError reports whether err is a DNS failure rather than a malformed or ambiguous record.
+func isLookupError(ctx context.Context, err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || ctx.Err() != nil
+}
+
+func isSPF(txt string) bool {
+	return len(txt) >= 6 && strings.EqualFold(txt[:6], "v=spf1") && (len(txt) == 6 || txt[6] == ' ')
+}
+
+func isDMARC(txt string) bool {
+	v, _, _ := strings.Cut(txt, ";")
+	return strings.EqualFold(strings.ReplaceAll(v, " ", ""), "v=DMARC1")
+}
+
+func isDKIM(txt string) bool {
+	// The version tag is optional, so a key record is recognized by its public key tag.
+	tags := parseTags(txt)
+	if v, ok := tags["v"]; ok {
+		return v == "DKIM1"
+	}
+	_, ok := tags["p"]
+	return ok
+}
+
+// parseTags parses a tag=value list separated by semicolons. Tag names are lowercased.
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(raw, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+func splitURIs(value string) []string {
+	var uris []string
+	for _, uri := range strings.Split(value, ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
@@ -0,0 +1,339 @@
+package domainutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// txtHandler answers TXT queries from zone, a map of names to the TXT records at each name.
+func txtHandler(zone map[string][][]string) stubHandler {
+	return func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		var msg dnsmessage.Message
+		name := strings.TrimSuffix(q.Name.String(), ".")
+		records, ok := zone[name]
+		if !ok {
+			msg.RCode = dnsmessage.RCodeNameError
+			return msg
+		}
+		if q.Type == dnsmessage.TypeTXT {
+			for _, txt := range records {
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader(q.Name.String(), dnsmessage.TypeTXT, 300), Body: &dnsmessage.TXTResource{TXT: txt}})
+			}
+		}
+		return msg
+	}
+}
+
+func newMailResolver(t *testing.T, zone map[string][][]string) *Resolver {
+	t.Helper()
+	r, err := NewResolver(ResolverOptions{Servers: []string{newStubServer(t, txtHandler(zone))}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	return r
+}
+
+func dkimKey(t *testing.T, bits int) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func hasIssue(issues []MailIssue, record, substr string) bool {
+	for _, i := range issues {
+		if i.Record == record && strings.Contains(i.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseSPF(t *testing.T) {
+	spf, err := ParseSPF("v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 a mx:mail.example.com/24 include:_spf.example.net ~all exp=explain.example.com")
+	if err != nil {
+		t.Fatalf("ParseSPF failed: %v", err)
+	}
+
+	want := []SPFMechanism{
+		{Qualifier: "+", Name: "ip4", Value: "192.0.2.0/24"},
+		{Qualifier: "+", Name: "ip6", Value: "2001:db8::/32"},
+		{Qualifier: "+", Name: "a"},
+		{Qualifier: "+", Name: "mx", Value: "mail.example.com/24"},
+		{Qualifier: "+", Name: "include", Value: "_spf.example.net"},
+		{Qualifier: "~", Name: "all"},
+	}
+	if len(spf.Mechanisms) != len(want) {
+		t.Fatalf("ParseSPF returned %d mechanisms; want %d", len(spf.Mechanisms), len(want))
+	}
+	for i, m := range spf.Mechanisms {
+		if m != want[i] {
+			t.Errorf("Mechanisms[%d] = %+v; want %+v", i, m, want[i])
+		}
+	}
+	if spf.Explanation != "explain.example.com" {
+		t.Errorf("Explanation = %q; want %q", spf.Explanation, "explain.example.com")
+	}
+
+	invalid := []string{
+		"v=spf10 -all",
+		"v=spf1 ip4:2001:db8::1 -all",
+		"v=spf1 ip6:192.0.2.1 -all",
+		"v=spf1 ip4:192.0.2.0/33 -all",
+		"v=spf1 include -all",
+		"v=spf1 foo:bar -all",
+		"v=spf1 redirect=a.example.com redirect=b.example.com",
+	}
+	for _, raw := range invalid {
+		if _, err := ParseSPF(raw); err == nil {
+			t.Errorf("ParseSPF(%q) succeeded; want error", raw)
+		}
+	}
+}
+
+func TestParseDMARC(t *testing.T) {
+	d, err := ParseDMARC("v=DMARC1; p=Quarantine; sp=none; pct=50; rua=mailto:a@example.com, mailto:b@example.com; adkim=s")
+	if err != nil {
+		t.Fatalf("ParseDMARC failed: %v", err)
+	}
+	if d.Policy != "quarantine" || d.SubdomainPolicy != "none" || d.Percent != 50 || d.ADKIM != "s" || d.ASPF != "r" {
+		t.Errorf("ParseDMARC returned %+v", d)
+	}
+	if len(d.RUA) != 2 || d.RUA[1] != "mailto:b@example.com" {
+		t.Errorf("RUA = %v; want two addresses", d.RUA)
+	}
+
+	for _, want := range []string{"sp=none", "50%"} {
+		if !hasIssue(d.Issues(), "DMARC", want) {
+			t.Errorf("Issues() = %+v; want an issue mentioning %q", d.Issues(), want)
+		}
+	}
+
+	for _, raw := range []string{"v=DMARC1; rua=mailto:a@example.com", "v=DMARC1; p=block", "v=DMARC1; p=none; pct=150", "v=spf1 -all"} {
+		if _, err := ParseDMARC(raw); err == nil {
+			t.Errorf("ParseDMARC(%q) succeeded; want error", raw)
+		}
+	}
+}
+
+func TestParseDKIM(t *testing.T) {
+	key := dkimKey(t, 1024)
+	d, err := ParseDKIM("v=DKIM1; k=rsa; t=y; p=" + key)
+	if err != nil {
+		t.Fatalf("ParseDKIM failed: %v", err)
+	}
+	if d.KeyType != "rsa" || d.KeyBits != 1024 || !d.Testing || d.Revoked {
+		t.Errorf("ParseDKIM returned %+v", d)
+	}
+	if !hasIssue(d.Issues(), "DKIM", "1024 bits") || !hasIssue(d.Issues(), "DKIM", "testing") {
+		t.Errorf("Issues() = %+v; want key size and testing issues", d.Issues())
+	}
+
+	d, err = ParseDKIM("v=DKIM1; p=")
+	if err != nil {
+		t.Fatalf("ParseDKIM failed: %v", err)
+	}
+	if !d.Revoked {
+		t.Errorf("ParseDKIM(%q).Revoked = false; want true", d.Raw)
+	}
+
+	for _, raw := range []string{"v=DKIM1; k=rsa", "v=DKIM1; p=not base64!", "v=DKIM1; p=AAAA"} {
+		if _, err := ParseDKIM(raw); err == nil {
+			t.Errorf("ParseDKIM(%q) succeeded; want error", raw)
+		}
+	}
+}
+
+func TestLookupSPF(t *testing.T) {
+	r := newMailResolver(t, map[string][][]string{
+		"example.com":         {{"v=spf1 mx include:_spf.example.com ", "include:missing.example.com -all"}, {"google-site-verification=abc"}},
+		"_spf.example.com":    {{"v=spf1 a include:_spf2.example.com ?all"}},
+		"_spf2.example.com":   {{"v=spf1 include:_spf.example.com ip4:192.0.2.1 -all"}},
+		"missing.example.com": {{"not spf"}},
+		"redir.example.com":   {{"v=spf1 redirect=_spf.example.com"}},
+	})
+
+	spf, err := r.LookupSPF(context.Background(), "Example.COM.")
+	if err != nil {
+		t.Fatalf("LookupSPF failed: %v", err)
+	}
+	if spf.Domain != "example.com" || len(spf.Mechanisms) != 4 {
+		t.Fatalf("LookupSPF returned %+v", spf)
+	}
+
+	include := spf.Mechanisms[1]
+	if include.Record == nil || include.Record.Domain != "_spf.example.com" {
+		t.Fatalf("include record = %+v; want _spf.example.com", include.Record)
+	}
+	nested := include.Record.Mechanisms[1]
+	if nested.Record == nil || !strings.Contains(nested.Record.Mechanisms[0].Error, "loop") {
+		t.Errorf("nested include = %+v; want an include loop error", nested.Record)
+	}
+	if spf.Mechanisms[2].Record != nil || !strings.Contains(spf.Mechanisms[2].Error, "no SPF record") {
+		t.Errorf("missing include = %+v; want a not found error", spf.Mechanisms[2])
+	}
+	// mx, include x2 here; a, include in _spf; include in _spf2.
+	if spf.Lookups != 6 {
+		t.Errorf("Lookups = %d; want 6", spf.Lookups)
+	}
+
+	redir, err := r.LookupSPF(context.Background(), "redir.example.com")
+	if err != nil {
+		t.Fatalf("LookupSPF failed: %v", err)
+	}
+	if redir.RedirectRecord == nil || redir.Lookups != 4 {
+		t.Errorf("redirect record = %+v, Lookups = %d; want _spf.example.com, 4", redir.RedirectRecord, redir.Lookups)
+	}
+	if !hasIssue(redir.Issues(), "SPF", "?all") {
+		t.Errorf("Issues() = %+v; want the ?all of the redirect target", redir.Issues())
+	}
+
+	_, err = r.LookupSPF(context.Background(), "missing.example.com")
+	if !isNotFound(err) {
+		t.Errorf("LookupSPF(missing.example.com) error = %v; want not found", err)
+	}
+}
+
+func TestLookupSPFTooManyLookups(t *testing.T) {
+	zone := map[string][][]string{}
+	var includes []string
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("_spf%d.example.com", i)
+		zone[name] = [][]string{{"v=spf1 a -all"}}
+		includes = append(includes, "include:"+name)
+	}
+	zone["example.com"] = [][]string{{"v=spf1 " + strings.Join(includes, " ") + " +all"}}
+	r := newMailResolver(t, zone)
+
+	spf, err := r.LookupSPF(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupSPF failed: %v", err)
+	}
+	// The last include is not followed once 10 lookups are exceeded.
+	if spf.Lookups != 11 || spf.Mechanisms[5].Record != nil {
+		t.Errorf("Lookups = %d, last include = %+v; want 11 and the last include not followed", spf.Lookups, spf.Mechanisms[5])
+	}
+	for _, want := range []string{"11 DNS lookups", "+all", "limit of 10"} {
+		if !hasIssue(spf.Issues(), "SPF", want) {
+			t.Errorf("Issues() = %+v; want an issue mentioning %q", spf.Issues(), want)
+		}
+	}
+}
+
+func TestLookupSPFFanOut(t *testing.T) {
+	// Each record includes the next one three times, which would cause 3^n lookups if every
+	// include was followed.
+	zone := map[string][][]string{}
+	for i := 0; i < 12; i++ {
+		next := fmt.Sprintf("include:_spf%d.example.com", i+1)
+		zone[fmt.Sprintf("_spf%d.example.com", i)] = [][]string{{"v=spf1 " + strings.Repeat(next+" ", 3) + "-all"}}
+	}
+	var queries int32
+	handler := txtHandler(zone)
+	server := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		atomic.AddInt32(&queries, 1)
+		return handler(q, tcp)
+	})
+	r, err := NewResolver(ResolverOptions{Servers: []string{server}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	spf, err := r.LookupSPF(context.Background(), "_spf0.example.com")
+	if err != nil {
+		t.Fatalf("LookupSPF failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&queries); n > maxSPFLookups {
+		t.Errorf("LookupSPF sent %d queries; want at most %d", n, maxSPFLookups)
+	}
+	if spf.Lookups <= maxSPFLookups || spf.Lookups > 2*maxSPFLookups {
+		t.Errorf("Lookups = %d; want just over %d", spf.Lookups, maxSPFLookups)
+	}
+	if !hasIssue(spf.Issues(), "SPF", "limit of 10") {
+		t.Errorf("Issues() = %+v; want an issue about the lookup limit", spf.Issues())
+	}
+}
+
+func TestLookupDMARC(t *testing.T) {
+	r := newMailResolver(t, map[string][][]string{
+		"_dmarc.example.com":     {{"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"}},
+		"_dmarc.dup.example.net": {{"v=DMARC1; p=none"}, {"v=DMARC1; p=reject"}},
+	})
+
+	d, err := r.LookupDMARC(context.Background(), "mail.example.com")
+	if err != nil {
+		t.Fatalf("LookupDMARC failed: %v", err)
+	}
+	if d.Domain != "example.com" || d.Policy != "reject" || len(d.Issues()) != 0 {
+		t.Errorf("LookupDMARC(mail.example.com) = %+v; want the example.com policy without issues", d)
+	}
+
+	if _, err := r.LookupDMARC(context.Background(), "dup.example.net"); err == nil || isNotFound(err) {
+		t.Errorf("LookupDMARC(dup.example.net) error = %v; want multiple records error", err)
+	}
+	if _, err := r.LookupDMARC(context.Background(), "example.org"); !isNotFound(err) {
+		t.Errorf("LookupDMARC(example.org) error = %v; want not found", err)
+	}
+}
+
+func TestAuditMail(t *testing.T) {
+	key := dkimKey(t, 2048)
+	r := newMailResolver(t, map[string][][]string{
+		"example.com":                    {{"v=spf1 ptr"}},
+		"_dmarc.example.com":             {{"v=DMARC1; p=none"}},
+		"s1._domainkey.example.com":      {{"v=DKIM1; k=rsa; p=", key[:200], key[200:]}},
+		"revoked._domainkey.example.com": {{"v=DKIM1; p="}},
+		"secure.example.net":             {{"v=spf1 -all"}},
+	})
+
+	report, err := r.AuditMail(context.Background(), "example.com", []string{"s1", "revoked", "missing"})
+	if err != nil {
+		t.Fatalf("AuditMail failed: %v", err)
+	}
+	if report.SPF == nil || report.DMARC == nil || len(report.DKIM) != 2 || report.DKIM[0].KeyBits != 2048 {
+		t.Fatalf("AuditMail returned %+v", report)
+	}
+
+	tests := []struct {
+		record string
+		substr string
+	}{
+		{"SPF", "no all mechanism"},
+		{"SPF", "ptr"},
+		{"DMARC", "p=none"},
+		{"DMARC", "rua"},
+		{"DKIM", "revoked"},
+		{"DKIM", `selector "missing"`},
+	}
+	for _, test := range tests {
+		if !hasIssue(report.Issues, test.record, test.substr) {
+			t.Errorf("AuditMail issues = %+v; want %s issue mentioning %q", report.Issues, test.record, test.substr)
+		}
+	}
+	if hasIssue(report.Issues, "DKIM", `"s1"`) {
+		t.Errorf("AuditMail issues = %+v; want no issue for selector s1", report.Issues)
+	}
+
+	report, err = r.AuditMail(context.Background(), "secure.example.net", nil)
+	if err != nil {
+		t.Fatalf("AuditMail failed: %v", err)
+	}
+	if !hasIssue(report.Issues, "DMARC", "no DMARC record") || len(report.Issues) != 1 {
+		t.Errorf("AuditMail(secure.example.net) issues = %+v; want only a missing DMARC issue", report.Issues)
+	}
+}
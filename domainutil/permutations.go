@@ -0,0 +1,258 @@
+package domainutil
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// PermutationOptions controls the alterations produced by GeneratePermutations.
+// Nil word lists are replaced by their defaults; pass an empty slice to disable one.
+type PermutationOptions struct {
+	Words        []string // generic words, default DefaultPermutationWords()
+	Environments []string // environment tokens, default DefaultEnvironments()
+	Regions      []string // region tokens, default DefaultRegions()
+	NumberRange  int      // how far numbers in labels are incremented and decremented (default 3)
+	NoNumbers    bool     // leave numbers in labels unchanged
+}
+
+// DefaultPermutationWords returns common words found in subdomain labels.
+func DefaultPermutationWords() []string {
+	return []string{
+		"admin", "api", "app", "auth", "backend", "beta", "cdn", "dashboard", "db", "demo",
+		"docs", "gateway", "git", "internal", "legacy", "m", "mail", "new", "old", "portal",
+		"private", "secure", "static", "v1", "v2", "vpn", "web", "www",
+	}
+}
+
+// DefaultEnvironments returns common deployment environment tokens.
+func DefaultEnvironments() []string {
+	return []string{
+		"dev", "development", "int", "preprod", "prod", "production", "qa", "sandbox",
+		"stage", "staging", "stg", "test", "uat",
+	}
+}
+
+// DefaultRegions returns common cloud region tokens.
+func DefaultRegions() []string {
+	return []string{
+		"ap", "apac", "ap-northeast-1", "ap-southeast-1", "eu", "eu-central-1", "eu-west-1",
+		"us", "us-east-1", "us-east-2", "us-west-1", "us-west-2",
+	}
+}
+
+// GeneratePermutations streams altdns/dnsgen-style alterations of known subdomains:
+// word insertion as a new label, dash joins with existing labels, replacement of known
+// words inside labels, and incremented or decremented numbers. Results are generated lazily,
+// deduplicated, never include the input names, and are valid hostnames under the same root domain.
+// The returned channel is closed once all permutations are sent or ctx is done.
+func GeneratePermutations(ctx context.Context, subdomains []string, opts PermutationOptions) <-chan string {
+	opts = opts.withDefaults()
+	out := make(chan string)
+
+	tokens := uniqueTokens(opts.Words, opts.Environments, opts.Regions)
+	known := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		known[token] = true
+	}
+
+	go func() {
+		defer close(out)
+
+		seen := make(map[string]bool)
+		for _, sub := range subdomains {
+			seen[normalizeName(sub)] = true
+		}
+
+		emit := func(labels []string, root string) bool {
+			name := root
+			if len(labels) > 0 {
+				name = strings.Join(labels, ".") + "." + root
+			}
+			if seen[name] || !isValidHostname(name) {
+				return true
+			}
+			seen[name] = true
+			select {
+			case out <- name:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, sub := range subdomains {
+			sub = strings.TrimPrefix(normalizeName(sub), "*.")
+			root := GetRootDomain(sub)
+			if root == "" || !IsValidDomain(sub) {
+				continue
+			}
+			var labels []string
+			if rest := strings.TrimSuffix(sub, root); rest != "" {
+				labels = strings.Split(strings.TrimSuffix(rest, "."), ".")
+			}
+
+			p := permuter{labels: labels, root: root, tokens: tokens, known: known, emit: emit}
+			if !opts.NoNumbers {
+				p.numberRange = opts.NumberRange
+			}
+			if !p.run() {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// permuter generates the permutations of a single subdomain.
+type permuter struct {
+	labels      []string // labels left of the root domain
+	root        string
+	tokens      []string
+	known       map[string]bool
+	numberRange int // 0 if numbers are left unchanged
+	emit        func(labels []string, root string) bool
+}
+
+func (p *permuter) run() bool {
+	return p.insertWords() && p.joinWords() && p.replaceWords() && p.shiftNumbers()
+}
+
+// insertWords adds each token as a new label at every position, e.g. dev.api.example.com.
+func (p *permuter) insertWords() bool {
+	for _, token := range p.tokens {
+		for i := 0; i <= len(p.labels); i++ {
+			labels := make([]string, 0, len(p.labels)+1)
+			labels = append(labels, p.labels[:i]...)
+			labels = append(labels, token)
+			labels = append(labels, p.labels[i:]...)
+			if !p.emit(labels, p.root) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// joinWords joins each token to every label with a dash, e.g. dev-api.example.com and api-dev.example.com.
+func (p *permuter) joinWords() bool {
+	for _, token := range p.tokens {
+		for i, label := range p.labels {
+			for _, joined := range []string{token + "-" + label, label + "-" + token} {
+				if !p.emit(p.replaceLabel(i, joined), p.root) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// replaceWords swaps known tokens inside dash-separated labels, e.g. api-dev.example.com to api-staging.example.com.
+func (p *permuter) replaceWords() bool {
+	for i, label := range p.labels {
+		parts := strings.Split(label, "-")
+		for j, part := range parts {
+			if !p.known[part] {
+				continue
+			}
+			for _, token := range p.tokens {
+				if token == part {
+					continue
+				}
+				replaced := append([]string(nil), parts...)
+				replaced[j] = token
+				if !p.emit(p.replaceLabel(i, strings.Join(replaced, "-")), p.root) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// shiftNumbers increments and decrements every number found in a label, keeping zero padding,
+// e.g. api2.example.com to api1.example.com and api3.example.com.
+func (p *permuter) shiftNumbers() bool {
+	for i, label := range p.labels {
+		for _, span := range digitSpans(label) {
+			digits := label[span[0]:span[1]]
+			n, err := strconv.Atoi(digits)
+			if err != nil {
+				continue
+			}
+			for delta := -p.numberRange; delta <= p.numberRange; delta++ {
+				if delta == 0 || n+delta < 0 {
+					continue
+				}
+				num := strconv.Itoa(n + delta)
+				if len(num) < len(digits) {
+					num = strings.Repeat("0", len(digits)-len(num)) + num
+				}
+				if !p.emit(p.replaceLabel(i, label[:span[0]]+num+label[span[1]:]), p.root) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (p *permuter) replaceLabel(i int, label string) []string {
+	labels := append([]string(nil), p.labels...)
+	labels[i] = label
+	return labels
+}
+
+// digitSpans returns the start and end offsets of every run of digits in s.
+func digitSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		isDigit := i < len(s) && s[i] >= '0' && s[i] <= '9'
+		if isDigit && start < 0 {
+			start = i
+		} else if !isDigit && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	return spans
+}
+
+// isValidHostname checks a generated name against the domain name rules and length limits.
+func isValidHostname(name string) bool {
+	return len(name) <= 253 && IsValidDomain(name)
+}
+
+func uniqueTokens(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, list := range lists {
+		for _, token := range list {
+			token = strings.ToLower(strings.TrimSpace(token))
+			if token != "" && !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+func (o PermutationOptions) withDefaults() PermutationOptions {
+	if o.Words == nil {
+		o.Words = DefaultPermutationWords()
+	}
+	if o.Environments == nil {
+		o.Environments = DefaultEnvironments()
+	}
+	if o.Regions == nil {
+		o.Regions = DefaultRegions()
+	}
+	if o.NumberRange <= 0 {
+		o.NumberRange = 3
+	}
+	return o
+}
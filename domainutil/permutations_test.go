@@ -0,0 +1,86 @@
+package domainutil
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGeneratePermutations(t *testing.T) {
+	opts := PermutationOptions{
+		Words:        []string{"api"},
+		Environments: []string{"dev", "stage"},
+		Regions:      []string{},
+		NumberRange:  1,
+	}
+
+	got := make(map[string]bool)
+	for name := range GeneratePermutations(context.Background(), []string{"app2.example.co.uk", "api-dev.example.co.uk"}, opts) {
+		if got[name] {
+			t.Errorf("Duplicate permutation %s", name)
+		}
+		got[name] = true
+		if !IsValidDomain(name) {
+			t.Errorf("Invalid permutation %s", name)
+		}
+		if GetRootDomain(name) != "example.co.uk" {
+			t.Errorf("Permutation %s left the root domain", name)
+		}
+	}
+
+	for _, want := range []string{
+		"dev.app2.example.co.uk",
+		"app2.stage.example.co.uk",
+		"dev-app2.example.co.uk",
+		"app2-api.example.co.uk",
+		"app1.example.co.uk",
+		"app3.example.co.uk",
+		"api-stage.example.co.uk",
+		"stage-dev.example.co.uk",
+	} {
+		if !got[want] {
+			t.Errorf("Expected permutation %s", want)
+		}
+	}
+
+	for _, unwanted := range []string{"app2.example.co.uk", "api-dev.example.co.uk", "app4.example.co.uk"} {
+		if got[unwanted] {
+			t.Errorf("Unexpected permutation %s", unwanted)
+		}
+	}
+}
+
+func TestGeneratePermutationsPadding(t *testing.T) {
+	opts := PermutationOptions{Words: []string{}, Environments: []string{}, Regions: []string{}, NumberRange: 2}
+
+	var got []string
+	for name := range GeneratePermutations(context.Background(), []string{"node01.example.com"}, opts) {
+		got = append(got, name)
+	}
+
+	want := []string{"node00.example.com", "node02.example.com", "node03.example.com"}
+	if len(got) != len(want) {
+		t.Fatalf("GeneratePermutations = %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GeneratePermutations = %v; want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestGeneratePermutationsNoNumbers(t *testing.T) {
+	opts := PermutationOptions{Words: []string{}, Environments: []string{}, Regions: []string{}, NoNumbers: true}
+	for name := range GeneratePermutations(context.Background(), []string{"node01.example.com"}, opts) {
+		t.Errorf("Unexpected permutation %s with NoNumbers", name)
+	}
+}
+
+func TestGeneratePermutationsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := GeneratePermutations(ctx, []string{"a.example.com", "b.example.com"}, PermutationOptions{})
+	<-out
+	cancel()
+	for range out {
+	}
+}
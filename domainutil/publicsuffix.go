@@ -0,0 +1,246 @@
+package domainutil
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+//go:embed public_suffix_list.dat
+var embeddedSuffixList string
+
+// Section selects which parts of the Public Suffix List are used when matching.
+type Section uint8
+
+const (
+	// ICANN holds the suffixes delegated by ICANN (com, co.uk, ...).
+	ICANN Section = 1 << iota
+	// Private holds suffixes submitted by private parties (github.io, s3.amazonaws.com, ...).
+	Private
+	// AllSections matches against both the ICANN and private sections.
+	AllSections = ICANN | Private
+)
+
+// SuffixList is a parsed Public Suffix List.
+type SuffixList struct {
+	rules    map[string]Section
+	sections Section
+}
+
+var (
+	suffixListMu   sync.RWMutex
+	suffixList     *SuffixList
+	suffixListOnce sync.Once
+)
+
+// ParseSuffixList parses a Public Suffix List in the publicsuffix.org format.
+// Rules are normalized to lowercase ASCII, so Unicode and punycode lists behave the same.
+func ParseSuffixList(r io.Reader) (*SuffixList, error) {
+	l := &SuffixList{
+		rules:    make(map[string]Section),
+		sections: AllSections,
+	}
+
+	section := ICANN
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "//"):
+			if strings.Contains(line, "===BEGIN PRIVATE DOMAINS===") {
+				section = Private
+			} else if strings.Contains(line, "===BEGIN ICANN DOMAINS===") {
+				section = ICANN
+			}
+			continue
+		}
+
+		// Only the first whitespace-delimited field is part of the rule.
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+
+		prefix := ""
+		switch {
+		case strings.HasPrefix(line, "!"):
+			prefix, line = "!", line[1:]
+		case strings.HasPrefix(line, "*."):
+			prefix, line = "*.", line[2:]
+		}
+
+		ascii, err := toASCII(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public suffix rule %q: %v", prefix+line, err)
+		}
+		l.rules[prefix+ascii] = section
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// LoadSuffixList parses a Public Suffix List from a file.
+func LoadSuffixList(filePath string) (*SuffixList, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseSuffixList(f)
+}
+
+// DefaultSuffixList returns the list used by the package-level helpers.
+// Unless replaced with SetSuffixList, this is the snapshot embedded in the package.
+func DefaultSuffixList() *SuffixList {
+	suffixListOnce.Do(func() {
+		l, err := ParseSuffixList(strings.NewReader(embeddedSuffixList))
+		if err != nil {
+			panic("domainutil: embedded public suffix list: " + err.Error())
+		}
+		suffixListMu.Lock()
+		if suffixList == nil {
+			suffixList = l
+		}
+		suffixListMu.Unlock()
+	})
+
+	suffixListMu.RLock()
+	defer suffixListMu.RUnlock()
+	return suffixList
+}
+
+// SetSuffixList replaces the list used by the package-level helpers, e.g. with a freshly downloaded copy.
+func SetSuffixList(l *SuffixList) {
+	suffixListMu.Lock()
+	suffixList = l
+	suffixListMu.Unlock()
+}
+
+// Len returns the number of rules in the list.
+func (l *SuffixList) Len() int {
+	return len(l.rules)
+}
+
+// WithSections returns a view of the list that only matches rules from the given sections.
+func (l *SuffixList) WithSections(sections Section) *SuffixList {
+	return &SuffixList{rules: l.rules, sections: sections}
+}
+
+// PublicSuffix returns the public suffix (eTLD) of a domain, and whether it comes from the ICANN section.
+// If no rule matches, the last label is returned, as required by the implicit "*" rule.
+func (l *SuffixList) PublicSuffix(domain string) (suffix string, icann bool) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return "", false
+	}
+	labels := strings.Split(domain, ".")
+
+	// Exception rules take priority over every other match.
+	for i := range labels {
+		if section, ok := l.rule("!" + strings.Join(labels[i:], ".")); ok {
+			return strings.Join(labels[i+1:], "."), section == ICANN
+		}
+	}
+
+	// Otherwise the longest matching rule wins.
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		if section, ok := l.rule(name); ok {
+			return name, section == ICANN
+		}
+		if i+1 < len(labels) {
+			if section, ok := l.rule("*." + strings.Join(labels[i+1:], ".")); ok {
+				return name, section == ICANN
+			}
+		}
+	}
+
+	return labels[len(labels)-1], false
+}
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of a domain, e.g. "example.co.uk" for "shop.example.co.uk".
+// IP addresses have no registrable domain and return an error.
+func (l *SuffixList) RegistrableDomain(domain string) (string, error) {
+	name := normalizeDomain(domain)
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid domain: %q", domain)
+	}
+	if net.ParseIP(strings.Trim(name, "[]")) != nil {
+		return "", fmt.Errorf("%q is an IP address", domain)
+	}
+
+	suffix, _ := l.PublicSuffix(name)
+	if len(name) <= len(suffix) {
+		return "", fmt.Errorf("domain %q is a public suffix", domain)
+	}
+
+	rest := name[:len(name)-len(suffix)-1]
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix, nil
+}
+
+// Subdomain returns the part of a domain to the left of its registrable domain, e.g. "shop" for "shop.example.co.uk".
+// It returns an empty string if the domain has no subdomain part or no registrable domain.
+func (l *SuffixList) Subdomain(domain string) string {
+	registrable, err := l.RegistrableDomain(domain)
+	if err != nil {
+		return ""
+	}
+	name := normalizeDomain(domain)
+	return strings.TrimSuffix(strings.TrimSuffix(name, registrable), ".")
+}
+
+func (l *SuffixList) rule(name string) (Section, bool) {
+	section, ok := l.rules[name]
+	if !ok || section&l.sections == 0 {
+		return 0, false
+	}
+	return section, true
+}
+
+// PublicSuffix returns the public suffix (eTLD) of a domain using the default suffix list.
+func PublicSuffix(domain string) string {
+	suffix, _ := DefaultSuffixList().PublicSuffix(domain)
+	return suffix
+}
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of a domain using the default suffix list.
+func RegistrableDomain(domain string) (string, error) {
+	return DefaultSuffixList().RegistrableDomain(domain)
+}
+
+// Subdomain returns the subdomain part of a domain using the default suffix list.
+func Subdomain(domain string) string {
+	return DefaultSuffixList().Subdomain(domain)
+}
+
+// normalizeDomain lowercases a domain, strips a leading wildcard label and trailing dot,
+// and converts internationalized names to their ASCII form.
+func normalizeDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	domain = strings.TrimPrefix(domain, "*.")
+	if ascii, err := toASCII(domain); err == nil {
+		return ascii
+	}
+	return strings.ToLower(domain)
+}
+
+func toASCII(s string) (string, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return idna.Lookup.ToASCII(s)
+		}
+	}
+	return strings.ToLower(s), nil
+}
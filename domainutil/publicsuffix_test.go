@@ -0,0 +1,140 @@
+package domainutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPublicSuffix(t *testing.T) {
+	tests := []struct {
+		domain string
+		suffix string
+	}{
+		{"example.com", "com"},
+		{"shop.example.co.uk", "co.uk"},
+		{"foo.github.io", "github.io"},
+		{"a.b.ck", "b.ck"},
+		{"www.ck", "ck"},
+		{"x.city.kawasaki.jp", "kawasaki.jp"},
+		{"example.unknowntld", "unknowntld"},
+		{"bücher.de", "de"},
+	}
+
+	for _, test := range tests {
+		if suffix := PublicSuffix(test.domain); suffix != test.suffix {
+			t.Errorf("PublicSuffix(%s) = %s; want %s", test.domain, suffix, test.suffix)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		domain      string
+		registrable string
+		wantErr     bool
+	}{
+		{"example.com", "example.com", false},
+		{"shop.example.co.uk", "example.co.uk", false},
+		{"foo.bar.github.io", "bar.github.io", false},
+		{"www.ck", "www.ck", false},
+		{"example.com.", "example.com", false},
+		{"bücher.example.de", "example.de", false},
+		{"co.uk", "", true},
+		{"com", "", true},
+		{"a..example.com", "", true},
+		{"", "", true},
+		{"192.0.2.1", "", true},
+		{"2001:db8::1", "", true},
+		{"[::1]", "", true},
+	}
+
+	for _, test := range tests {
+		registrable, err := RegistrableDomain(test.domain)
+		if (err != nil) != test.wantErr {
+			t.Errorf("RegistrableDomain(%s) error = %v; wantErr %v", test.domain, err, test.wantErr)
+			continue
+		}
+		if registrable != test.registrable {
+			t.Errorf("RegistrableDomain(%s) = %s; want %s", test.domain, registrable, test.registrable)
+		}
+	}
+}
+
+func TestSubdomain(t *testing.T) {
+	tests := []struct {
+		domain    string
+		subdomain string
+	}{
+		{"shop.example.co.uk", "shop"},
+		{"a.b.example.com", "a.b"},
+		{"example.com", ""},
+		{"co.uk", ""},
+	}
+
+	for _, test := range tests {
+		if sub := Subdomain(test.domain); sub != test.subdomain {
+			t.Errorf("Subdomain(%s) = %s; want %s", test.domain, sub, test.subdomain)
+		}
+	}
+}
+
+func TestSuffixListSections(t *testing.T) {
+	list := DefaultSuffixList()
+
+	suffix, icann := list.PublicSuffix("foo.github.io")
+	if suffix != "github.io" || icann {
+		t.Errorf("PublicSuffix(foo.github.io) = %s, %v; want github.io, false", suffix, icann)
+	}
+
+	suffix, icann = list.WithSections(ICANN).PublicSuffix("foo.github.io")
+	if suffix != "io" || !icann {
+		t.Errorf("ICANN PublicSuffix(foo.github.io) = %s, %v; want io, true", suffix, icann)
+	}
+
+	suffix, _ = list.WithSections(Private).PublicSuffix("example.co.uk")
+	if suffix != "uk" {
+		t.Errorf("Private PublicSuffix(example.co.uk) = %s; want uk", suffix)
+	}
+}
+
+func TestParseSuffixList(t *testing.T) {
+	data := `// ===BEGIN ICANN DOMAINS===
+com
+*.test
+!keep.test
+// ===END ICANN DOMAINS===
+// ===BEGIN PRIVATE DOMAINS===
+apps.example.com
+// ===END PRIVATE DOMAINS===
+`
+	list, err := ParseSuffixList(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseSuffixList failed: %v", err)
+	}
+	if list.Len() != 4 {
+		t.Errorf("Len() = %d; want 4", list.Len())
+	}
+
+	tests := []struct {
+		domain      string
+		registrable string
+	}{
+		{"a.b.example.com", "example.com"},
+		{"x.apps.example.com", "x.apps.example.com"},
+		{"foo.bar.test", "foo.bar.test"},
+		{"a.keep.test", "keep.test"},
+	}
+	for _, test := range tests {
+		registrable, err := list.RegistrableDomain(test.domain)
+		if err != nil || registrable != test.registrable {
+			t.Errorf("RegistrableDomain(%s) = %s, %v; want %s", test.domain, registrable, err, test.registrable)
+		}
+	}
+
+	prev := DefaultSuffixList()
+	SetSuffixList(list)
+	defer SetSuffixList(prev)
+	if root := GetRootDomain("x.apps.example.com"); root != "x.apps.example.com" {
+		t.Errorf("GetRootDomain with custom list = %s; want x.apps.example.com", root)
+	}
+}
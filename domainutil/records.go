@@ -0,0 +1,614 @@
+package domainutil
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Record types that dnsmessage does not define.
+const (
+	TypeNAPTR      dnsmessage.Type = 35
+	TypeDNAME      dnsmessage.Type = 39
+	TypeDS         dnsmessage.Type = 43
+	TypeSSHFP      dnsmessage.Type = 44
+	TypeRRSIG      dnsmessage.Type = 46
+	TypeNSEC       dnsmessage.Type = 47
+	TypeDNSKEY     dnsmessage.Type = 48
+	TypeNSEC3      dnsmessage.Type = 50
+	TypeNSEC3PARAM dnsmessage.Type = 51
+	TypeTLSA       dnsmessage.Type = 52
+	TypeCDS        dnsmessage.Type = 59
+	TypeCDNSKEY    dnsmessage.Type = 60
+	TypeSVCB       dnsmessage.Type = 64
+	TypeHTTPS      dnsmessage.Type = 65
+	TypeSPF        dnsmessage.Type = 99
+	TypeCAA        dnsmessage.Type = 257
+)
+
+// maxCNAMEChain bounds how many CNAME hops are followed.
+const maxCNAMEChain = 16
+
+var typeNames = map[dnsmessage.Type]string{
+	dnsmessage.TypeA:     "A",
+	dnsmessage.TypeNS:    "NS",
+	dnsmessage.TypeCNAME: "CNAME",
+	dnsmessage.TypeSOA:   "SOA",
+	dnsmessage.TypePTR:   "PTR",
+	dnsmessage.TypeMX:    "MX",
+	dnsmessage.TypeTXT:   "TXT",
+	dnsmessage.TypeAAAA:  "AAAA",
+	dnsmessage.TypeSRV:   "SRV",
+	dnsmessage.TypeOPT:   "OPT",
+	dnsmessage.TypeAXFR:  "AXFR",
+	TypeIXFR:             "IXFR",
+	dnsmessage.TypeALL:   "ANY",
+	dnsmessage.TypeHINFO: "HINFO",
+	TypeNAPTR:            "NAPTR",
+	TypeDNAME:            "DNAME",
+	TypeDS:               "DS",
+	TypeSSHFP:            "SSHFP",
+	TypeRRSIG:            "RRSIG",
+	TypeNSEC:             "NSEC",
+	TypeDNSKEY:           "DNSKEY",
+	TypeNSEC3:            "NSEC3",
+	TypeNSEC3PARAM:       "NSEC3PARAM",
+	TypeTLSA:             "TLSA",
+	TypeCDS:              "CDS",
+	TypeCDNSKEY:          "CDNSKEY",
+	TypeSVCB:             "SVCB",
+	TypeHTTPS:            "HTTPS",
+	TypeSPF:              "SPF",
+	TypeCAA:              "CAA",
+}
+
+// Response is the parsed outcome of a DNS query.
+type Response struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	RCode      string   `json:"rcode"`
+	Answers    []Record `json:"answers"`
+	Authority  []Record `json:"authority,omitempty"`
+	Additional []Record `json:"additional,omitempty"`
+}
+
+// Record is a single DNS resource record. Data always holds the record data in
+// zone file presentation format; the typed fields are set depending on Type.
+// Names are lowercase and have no trailing dot.
+type Record struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	TTL      uint32            `json:"ttl"`
+	Data     string            `json:"data"`
+	IP       net.IP            `json:"ip,omitempty"`       // A, AAAA
+	Target   string            `json:"target,omitempty"`   // CNAME, NS, PTR, MX, SRV, SVCB, HTTPS
+	Priority uint16            `json:"priority,omitempty"` // MX preference, SRV, SVCB and HTTPS priority
+	Weight   uint16            `json:"weight,omitempty"`   // SRV
+	Port     uint16            `json:"port,omitempty"`     // SRV
+	Text     []string          `json:"text,omitempty"`     // TXT
+	SOA      *SOAData          `json:"soa,omitempty"`      // SOA
+	CAA      *CAAData          `json:"caa,omitempty"`      // CAA
+	Params   map[string]string `json:"params,omitempty"`   // SVCB and HTTPS service parameters
+}
+
+// SOAData holds the fields of a SOA record.
+type SOAData struct {
+	NS      string `json:"ns"`
+	MBox    string `json:"mbox"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	MinTTL  uint32 `json:"minttl"`
+}
+
+// CAAData holds the fields of a CAA record.
+type CAAData struct {
+	Flags uint8  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// TypeString returns the mnemonic of a record type, e.g. "MX", or "TYPE<n>" for unknown types.
+func TypeString(t dnsmessage.Type) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// ParseType returns the record type for a mnemonic such as "MX" or "TYPE65".
+func ParseType(name string) (dnsmessage.Type, error) {
+	name = strings.ToUpper(name)
+	for t, n := range typeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	if strings.HasPrefix(name, "TYPE") {
+		if n, err := strconv.ParseUint(name[4:], 10, 16); err == nil {
+			return dnsmessage.Type(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown record type: %s", name)
+}
+
+// Lookup queries name for records of type qtype and returns every section of the response.
+// Unlike the typed lookups, it does not treat NXDOMAIN or other response codes as errors.
+func (r *Resolver) Lookup(ctx context.Context, name string, qtype dnsmessage.Type) (*Response, error) {
+	msg, err := r.Exchange(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(msg), nil
+}
+
+// LookupCNAME returns the CNAME chain of name, in order, starting with the record owned by name.
+// The chain is empty if name has no CNAME record.
+func (r *Resolver) LookupCNAME(ctx context.Context, name string) ([]Record, error) {
+	resp, err := r.Lookup(ctx, name, dnsmessage.TypeA)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := CNAMEChain(name, resp.Answers)
+	if len(chain) == 0 {
+		if err := responseError(resp, name); err != nil {
+			return nil, err
+		}
+	} else if resp.RCode != "NOERROR" && resp.RCode != "NXDOMAIN" {
+		return nil, responseError(resp, name)
+	}
+	return chain, nil
+}
+
+// LookupMX returns the MX records of name, sorted by preference.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]Record, error) {
+	records, err := r.lookupType(ctx, name, dnsmessage.TypeMX)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+	return records, err
+}
+
+// LookupNS returns the NS records of name.
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]Record, error) {
+	return r.lookupType(ctx, name, dnsmessage.TypeNS)
+}
+
+// LookupTXT returns the TXT records of name.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]Record, error) {
+	return r.lookupType(ctx, name, dnsmessage.TypeTXT)
+}
+
+// LookupSOA returns the SOA record of the zone name belongs to. If name is not a zone apex,
+// the SOA record from the authority section is returned instead.
+func (r *Resolver) LookupSOA(ctx context.Context, name string) (Record, error) {
+	resp, err := r.Lookup(ctx, name, dnsmessage.TypeSOA)
+	if err != nil {
+		return Record{}, err
+	}
+	if err := responseError(resp, name); err != nil {
+		return Record{}, err
+	}
+
+	for _, section := range [][]Record{resp.Answers, resp.Authority} {
+		for _, rec := range section {
+			if rec.Type == "SOA" {
+				return rec, nil
+			}
+		}
+	}
+	return Record{}, &net.DNSError{Err: "no SOA record found", Name: name, IsNotFound: true}
+}
+
+// LookupSRV returns the SRV records of _service._proto.name, sorted by priority.
+// If service and proto are empty, name is queried directly.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) ([]Record, error) {
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	records, err := r.lookupType(ctx, name, dnsmessage.TypeSRV)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+	return records, err
+}
+
+// LookupCAA returns the CAA records of name.
+func (r *Resolver) LookupCAA(ctx context.Context, name string) ([]Record, error) {
+	return r.lookupType(ctx, name, TypeCAA)
+}
+
+// LookupPTR returns the PTR records of an IP address.
+func (r *Resolver) LookupPTR(ctx context.Context, ip string) ([]Record, error) {
+	name, err := ReverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+	return r.lookupType(ctx, name, dnsmessage.TypePTR)
+}
+
+// LookupHTTPS returns the HTTPS records of name.
+func (r *Resolver) LookupHTTPS(ctx context.Context, name string) ([]Record, error) {
+	return r.lookupType(ctx, name, TypeHTTPS)
+}
+
+// LookupSVCB returns the SVCB records of name.
+func (r *Resolver) LookupSVCB(ctx context.Context, name string) ([]Record, error) {
+	return r.lookupType(ctx, name, TypeSVCB)
+}
+
+// lookupType returns the answers of type qtype that belong to name or to a name in its CNAME chain.
+func (r *Resolver) lookupType(ctx context.Context, name string, qtype dnsmessage.Type) ([]Record, error) {
+	resp, err := r.Lookup(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp, name); err != nil {
+		return nil, err
+	}
+
+	owners := map[string]bool{queryName(name): true}
+	for _, rec := range CNAMEChain(name, resp.Answers) {
+		owners[rec.Target] = true
+	}
+
+	want := TypeString(qtype)
+	var records []Record
+	for _, rec := range resp.Answers {
+		if rec.Type == want && owners[rec.Name] {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// CNAMEChain returns the CNAME records leading away from name, in order.
+func CNAMEChain(name string, records []Record) []Record {
+	var chain []Record
+	current := queryName(name)
+	seen := map[string]bool{current: true}
+
+	for len(chain) < maxCNAMEChain {
+		found := false
+		for _, rec := range records {
+			if rec.Type == "CNAME" && rec.Name == current {
+				chain = append(chain, rec)
+				current = rec.Target
+				found = true
+				break
+			}
+		}
+		if !found || seen[current] {
+			break
+		}
+		seen[current] = true
+	}
+	return chain
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name used for PTR lookups of an IP address.
+func ReverseName(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	if ip4 := parsed.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(parsed) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[parsed[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[parsed[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String(), nil
+}
+
+// responseError converts an unsuccessful response code to a *net.DNSError.
+func responseError(resp *Response, name string) error {
+	switch resp.RCode {
+	case "NOERROR":
+		return nil
+	case "NXDOMAIN":
+		return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return &net.DNSError{Err: "server responded with " + resp.RCode, Name: name}
+	}
+}
+
+func newResponse(msg *dnsmessage.Message) *Response {
+	resp := &Response{
+		RCode:      rcodeString(msg.RCode),
+		Answers:    recordsFromResources(msg.Answers),
+		Authority:  recordsFromResources(msg.Authorities),
+		Additional: recordsFromResources(msg.Additionals),
+	}
+	if len(msg.Questions) > 0 {
+		resp.Name = normalizeName(msg.Questions[0].Name.String())
+		resp.Type = TypeString(msg.Questions[0].Type)
+	}
+	return resp
+}
+
+func recordsFromResources(resources []dnsmessage.Resource) []Record {
+	var records []Record
+	for _, rr := range resources {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			continue
+		}
+		records = append(records, recordFromResource(rr))
+	}
+	return records
+}
+
+// recordFromResource converts a dnsmessage resource to a Record.
+func recordFromResource(rr dnsmessage.Resource) Record {
+	rec := Record{
+		Name: normalizeName(rr.Header.Name.String()),
+		Type: TypeString(rr.Header.Type),
+		TTL:  rr.Header.TTL,
+	}
+
+	switch body := rr.Body.(type) {
+	case *dnsmessage.AResource:
+		rec.IP = net.IP(body.A[:])
+		rec.Data = rec.IP.String()
+	case *dnsmessage.AAAAResource:
+		rec.IP = net.IP(body.AAAA[:])
+		rec.Data = rec.IP.String()
+	case *dnsmessage.CNAMEResource:
+		rec.setTarget(body.CNAME.String())
+	case *dnsmessage.NSResource:
+		rec.setTarget(body.NS.String())
+	case *dnsmessage.PTRResource:
+		rec.setTarget(body.PTR.String())
+	case *dnsmessage.MXResource:
+		rec.Priority = body.Pref
+		rec.Target = normalizeName(body.MX.String())
+		rec.Data = fmt.Sprintf("%d %s", body.Pref, body.MX.String())
+	case *dnsmessage.TXTResource:
+		rec.Text = body.TXT
+		rec.Data = quoteTXT(body.TXT)
+	case *dnsmessage.SRVResource:
+		rec.Priority, rec.Weight, rec.Port = body.Priority, body.Weight, body.Port
+		rec.Target = normalizeName(body.Target.String())
+		rec.Data = fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, body.Target.String())
+	case *dnsmessage.SOAResource:
+		rec.SOA = &SOAData{
+			NS:      normalizeName(body.NS.String()),
+			MBox:    normalizeName(body.MBox.String()),
+			Serial:  body.Serial,
+			Refresh: body.Refresh,
+			Retry:   body.Retry,
+			Expire:  body.Expire,
+			MinTTL:  body.MinTTL,
+		}
+		rec.Data = fmt.Sprintf("%s %s %d %d %d %d %d", body.NS.String(), body.MBox.String(),
+			body.Serial, body.Refresh, body.Retry, body.Expire, body.MinTTL)
+	case *dnsmessage.UnknownResource:
+		rec.setUnknown(rr.Header.Type, body.Data)
+	}
+
+	return rec
+}
+
+func (rec *Record) setTarget(name string) {
+	rec.Target = normalizeName(name)
+	rec.Data = name
+}
+
+// setUnknown decodes record types that dnsmessage returns as raw data.
+func (rec *Record) setUnknown(t dnsmessage.Type, data []byte) {
+	var err error
+	switch t {
+	case TypeCAA:
+		err = rec.setCAA(data)
+	case TypeSVCB, TypeHTTPS:
+		err = rec.setSVCB(data)
+	default:
+		err = errors.New("unsupported type")
+	}
+	if err != nil {
+		// RFC 3597 generic presentation format.
+		rec.Data = fmt.Sprintf(`\# %d %s`, len(data), hex.EncodeToString(data))
+	}
+}
+
+func (rec *Record) setCAA(data []byte) error {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return errors.New("short CAA record")
+	}
+	rec.CAA = &CAAData{
+		Flags: data[0],
+		Tag:   string(data[2 : 2+data[1]]),
+		Value: string(data[2+data[1]:]),
+	}
+	rec.Data = fmt.Sprintf("%d %s %s", rec.CAA.Flags, rec.CAA.Tag, quoteString(rec.CAA.Value))
+	return nil
+}
+
+var svcParamKeys = []string{"mandatory", "alpn", "no-default-alpn", "port", "ipv4hint", "ech", "ipv6hint"}
+
+func (rec *Record) setSVCB(data []byte) error {
+	if len(data) < 3 {
+		return errors.New("short SVCB record")
+	}
+	priority := binary.BigEndian.Uint16(data)
+	target, off, err := readWireName(data, 2)
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string]string)
+	parts := []string{strconv.Itoa(int(priority)), target}
+	for off < len(data) {
+		if off+4 > len(data) {
+			return errors.New("short SVCB parameter")
+		}
+		key := binary.BigEndian.Uint16(data[off:])
+		length := int(binary.BigEndian.Uint16(data[off+2:]))
+		off += 4
+		if off+length > len(data) {
+			return errors.New("short SVCB parameter")
+		}
+		name, value := formatSvcParam(key, data[off:off+length])
+		off += length
+
+		params[name] = value
+		if value == "" {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts, name+"="+value)
+		}
+	}
+
+	rec.Priority = priority
+	rec.Target = normalizeName(target)
+	if len(params) > 0 {
+		rec.Params = params
+	}
+	rec.Data = strings.Join(parts, " ")
+	return nil
+}
+
+// formatSvcParam returns the presentation name and value of an SVCB parameter (RFC 9460).
+func formatSvcParam(key uint16, value []byte) (string, string) {
+	name := "key" + strconv.Itoa(int(key))
+	if int(key) < len(svcParamKeys) {
+		name = svcParamKeys[key]
+	}
+
+	switch key {
+	case 0: // mandatory
+		var keys []string
+		for i := 0; i+1 < len(value); i += 2 {
+			k, _ := formatSvcParam(binary.BigEndian.Uint16(value[i:]), nil)
+			keys = append(keys, k)
+		}
+		return name, strings.Join(keys, ",")
+	case 1: // alpn
+		var ids []string
+		for i := 0; i < len(value); {
+			n := int(value[i])
+			if i+1+n > len(value) {
+				break
+			}
+			ids = append(ids, string(value[i+1:i+1+n]))
+			i += 1 + n
+		}
+		return name, strings.Join(ids, ",")
+	case 3: // port
+		if len(value) == 2 {
+			return name, strconv.Itoa(int(binary.BigEndian.Uint16(value)))
+		}
+	case 4, 6: // ipv4hint, ipv6hint
+		size := net.IPv4len
+		if key == 6 {
+			size = net.IPv6len
+		}
+		var ips []string
+		for i := 0; i+size <= len(value); i += size {
+			ips = append(ips, net.IP(value[i:i+size]).String())
+		}
+		return name, strings.Join(ips, ",")
+	}
+
+	if len(value) == 0 {
+		return name, ""
+	}
+	return name, hex.EncodeToString(value)
+}
+
+// readWireName reads an uncompressed domain name from data at off.
+func readWireName(data []byte, off int) (string, int, error) {
+	var labels []string
+	for {
+		if off >= len(data) {
+			return "", off, errors.New("short domain name")
+		}
+		n := int(data[off])
+		off++
+		if n == 0 {
+			break
+		}
+		if n > 63 || off+n > len(data) {
+			return "", off, errors.New("invalid domain name")
+		}
+		labels = append(labels, string(data[off:off+n]))
+		off += n
+	}
+	return strings.Join(labels, ".") + ".", off, nil
+}
+
+func quoteTXT(txt []string) string {
+	quoted := make([]string, len(txt))
+	for i, s := range txt {
+		quoted[i] = quoteString(s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteString quotes s as a zone file character-string, escaping quotes,
+// backslashes and non-printable bytes as \DDD.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// rcodeString returns the mnemonic of a response code, e.g. "NXDOMAIN".
+func rcodeString(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	}
+	return "RCODE" + strconv.Itoa(int(rcode))
+}
+
+// queryName returns name as it is sent in queries and appears in answers: converted to
+// punycode, lowercased and without its trailing dot.
+func queryName(name string) string {
+	return normalizeName(fqdn(name))
+}
+
+// normalizeName lowercases a DNS name and removes its trailing dot.
+func normalizeName(name string) string {
+	if name == "." {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
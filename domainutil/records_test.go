@@ -0,0 +1,259 @@
+package domainutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func recordsHandler(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+	name := q.Name.String()
+	var msg dnsmessage.Message
+	add := func(typ dnsmessage.Type, body dnsmessage.ResourceBody) {
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader(name, typ, 300), Body: body})
+	}
+	soa := dnsmessage.Resource{
+		Header: rrHeader("example.com.", dnsmessage.TypeSOA, 3600),
+		Body: &dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName("ns1.example.com."),
+			MBox:    dnsmessage.MustNewName("hostmaster.example.com."),
+			Serial:  2024010101,
+			Refresh: 7200,
+			Retry:   900,
+			Expire:  1209600,
+			MinTTL:  300,
+		},
+	}
+
+	switch {
+	case name == "example.com." && q.Type == dnsmessage.TypeMX:
+		add(dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 20, MX: dnsmessage.MustNewName("mx2.example.com.")})
+		add(dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx1.example.com.")})
+	case name == "xn--bcher-kva.example.com." && q.Type == dnsmessage.TypeMX:
+		add(dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.com.")})
+	case name == "example.com." && q.Type == dnsmessage.TypeNS:
+		add(dnsmessage.TypeNS, &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns1.example.com.")})
+	case name == "example.com." && q.Type == dnsmessage.TypeTXT:
+		add(dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"v=spf1 -all", `say "hi"`}})
+	case name == "example.com." && q.Type == dnsmessage.TypeSOA:
+		msg.Answers = append(msg.Answers, soa)
+	case name == "www.example.com." && q.Type == dnsmessage.TypeSOA:
+		msg.Authorities = append(msg.Authorities, soa)
+	case name == "_sip._tcp.example.com." && q.Type == dnsmessage.TypeSRV:
+		add(dnsmessage.TypeSRV, &dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 5060, Target: dnsmessage.MustNewName("sip.example.com.")})
+	case name == "example.com." && q.Type == TypeCAA:
+		add(TypeCAA, &dnsmessage.UnknownResource{Type: TypeCAA, Data: append([]byte{0, 5}, "issueletsencrypt.org"...)})
+	case name == "example.com." && q.Type == TypeHTTPS:
+		data := []byte{0, 1, 0}                                   // priority 1, target "."
+		data = append(data, 0, 1, 0, 6, 2, 'h', '2', 2, 'h', '3') // alpn=h2,h3
+		data = append(data, 0, 3, 0, 2, 0x01, 0xbb)               // port=443
+		data = append(data, 0, 4, 0, 4, 192, 0, 2, 1)             // ipv4hint=192.0.2.1
+		add(TypeHTTPS, &dnsmessage.UnknownResource{Type: TypeHTTPS, Data: data})
+	case name == "1.2.0.192.in-addr.arpa." && q.Type == dnsmessage.TypePTR:
+		add(dnsmessage.TypePTR, &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("host.example.com.")})
+	case name == "a.example.com." && q.Type == dnsmessage.TypeA:
+		msg.Answers = append(msg.Answers,
+			dnsmessage.Resource{Header: rrHeader("a.example.com.", dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("b.example.net.")}},
+			dnsmessage.Resource{Header: rrHeader("b.example.net.", dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("c.example.org.")}},
+		)
+		msg.RCode = dnsmessage.RCodeNameError
+	case name == "example.com.":
+	default:
+		msg.RCode = dnsmessage.RCodeNameError
+	}
+	return msg
+}
+
+func newRecordsResolver(t *testing.T) *Resolver {
+	t.Helper()
+	r, err := NewResolver(ResolverOptions{Servers: []string{newStubServer(t, recordsHandler)}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	return r
+}
+
+func TestLookupMX(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupMX(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupMX failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Target != "mx1.example.com" || records[0].Priority != 10 {
+		t.Fatalf("LookupMX returned %+v; want mx1.example.com first", records)
+	}
+	if records[0].Data != "10 mx1.example.com." || records[0].TTL != 300 {
+		t.Errorf("Unexpected MX record %+v", records[0])
+	}
+
+	records, err = r.LookupMX(context.Background(), "Bücher.example.com")
+	if err != nil {
+		t.Fatalf("LookupMX failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Name != "xn--bcher-kva.example.com" || records[0].Target != "mx.example.com" {
+		t.Errorf("LookupMX of an IDN returned %+v", records)
+	}
+
+	chain := CNAMEChain("bücher.example.com", []Record{{Name: "xn--bcher-kva.example.com", Type: "CNAME", Target: "cdn.example.net"}})
+	if len(chain) != 1 {
+		t.Errorf("CNAMEChain of an IDN returned %+v", chain)
+	}
+}
+
+func TestLookupTXT(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupTXT(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupTXT failed: %v", err)
+	}
+	if len(records) != 1 || len(records[0].Text) != 2 {
+		t.Fatalf("LookupTXT returned %+v", records)
+	}
+	if want := `"v=spf1 -all" "say \"hi\""`; records[0].Data != want {
+		t.Errorf("TXT data = %s; want %s", records[0].Data, want)
+	}
+}
+
+func TestLookupSOA(t *testing.T) {
+	r := newRecordsResolver(t)
+	for _, name := range []string{"example.com", "www.example.com"} {
+		rec, err := r.LookupSOA(context.Background(), name)
+		if err != nil {
+			t.Fatalf("LookupSOA(%s) failed: %v", name, err)
+		}
+		if rec.Name != "example.com" || rec.SOA == nil || rec.SOA.Serial != 2024010101 || rec.SOA.NS != "ns1.example.com" {
+			t.Errorf("LookupSOA(%s) returned %+v", name, rec)
+		}
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupSRV(context.Background(), "sip", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Port != 5060 || records[0].Target != "sip.example.com" || records[0].Data != "10 5 5060 sip.example.com." {
+		t.Errorf("LookupSRV returned %+v", records)
+	}
+}
+
+func TestLookupCAA(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupCAA(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupCAA failed: %v", err)
+	}
+	if len(records) != 1 || records[0].CAA == nil || records[0].CAA.Tag != "issue" || records[0].CAA.Value != "letsencrypt.org" {
+		t.Fatalf("LookupCAA returned %+v", records)
+	}
+	if want := `0 issue "letsencrypt.org"`; records[0].Data != want {
+		t.Errorf("CAA data = %s; want %s", records[0].Data, want)
+	}
+}
+
+func TestLookupHTTPS(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupHTTPS(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupHTTPS failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("LookupHTTPS returned %+v", records)
+	}
+	rec := records[0]
+	if want := "1 . alpn=h2,h3 port=443 ipv4hint=192.0.2.1"; rec.Data != want {
+		t.Errorf("HTTPS data = %s; want %s", rec.Data, want)
+	}
+	if rec.Priority != 1 || rec.Params["alpn"] != "h2,h3" || rec.Params["port"] != "443" {
+		t.Errorf("Unexpected HTTPS record %+v", rec)
+	}
+}
+
+func TestLookupPTR(t *testing.T) {
+	r := newRecordsResolver(t)
+	records, err := r.LookupPTR(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("LookupPTR failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Target != "host.example.com" {
+		t.Errorf("LookupPTR returned %+v", records)
+	}
+}
+
+func TestLookupCNAME(t *testing.T) {
+	r := newRecordsResolver(t)
+	chain, err := r.LookupCNAME(context.Background(), "a.example.com")
+	if err != nil {
+		t.Fatalf("LookupCNAME failed: %v", err)
+	}
+	if len(chain) != 2 || chain[0].Target != "b.example.net" || chain[1].Target != "c.example.org" {
+		t.Errorf("LookupCNAME returned %+v", chain)
+	}
+
+	_, err = r.LookupCNAME(context.Background(), "missing.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestLookupResponseJSON(t *testing.T) {
+	r := newRecordsResolver(t)
+	resp, err := r.Lookup(context.Background(), "www.example.com", dnsmessage.TypeSOA)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if resp.RCode != "NOERROR" || len(resp.Answers) != 0 || len(resp.Authority) != 1 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	for _, want := range []string{`"rcode":"NOERROR"`, `"type":"SOA"`, `"serial":2024010101`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s does not contain %s", data, want)
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip   string
+		name string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa"},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+	for _, test := range tests {
+		if name, err := ReverseName(test.ip); err != nil || name != test.name {
+			t.Errorf("ReverseName(%s) = %s, %v; want %s", test.ip, name, err, test.name)
+		}
+	}
+	if _, err := ReverseName("not-an-ip"); err == nil {
+		t.Errorf("Expected error for invalid IP")
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, name := range []string{"A", "mx", "HTTPS", "CAA", "ds", "RRSIG", "TYPE999"} {
+		typ, err := ParseType(name)
+		if err != nil {
+			t.Errorf("ParseType(%s) failed: %v", name, err)
+			continue
+		}
+		if !strings.EqualFold(TypeString(typ), name) {
+			t.Errorf("TypeString(ParseType(%s)) = %s", name, TypeString(typ))
+		}
+	}
+	if _, err := ParseType("BOGUS"); err == nil {
+		t.Errorf("Expected error for unknown type")
+	}
+}
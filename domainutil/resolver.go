@@ -0,0 +1,542 @@
+package domainutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// udpPayloadSize is the EDNS0 UDP payload size advertised in queries.
+const udpPayloadSize = 1232
+
+// ResolverOptions configures a Resolver.
+type ResolverOptions struct {
+	Servers     []string      // upstream DNS servers, e.g. "8.8.8.8", "tls://1.1.1.1:853" or "https://dns.google/dns-query"
+	Timeout     time.Duration // timeout for a single query to a single server (default 2s)
+	Retries     int           // additional servers to try after a failed query (default 2, negative for none)
+	RateLimit   int           // maximum queries per second sent to each server, 0 for no limit
+	MaxFailures int           // consecutive failures before a server is considered dead (default 5)
+	DeadTimeout time.Duration // how long a dead server is skipped before it is tried again (default 30s)
+	DoHMethod   string        // HTTP method used for DNS-over-HTTPS queries, "GET" (default) or "POST"
+	HTTPClient  *http.Client  // client used for DNS-over-HTTPS queries (default: a dedicated client using TLSConfig)
+	TLSConfig   *tls.Config   // TLS configuration used for DNS-over-TLS and the default DNS-over-HTTPS client
+}
+
+// DefaultResolverOptions returns the options used when fields of ResolverOptions are left unset.
+func DefaultResolverOptions() ResolverOptions {
+	return ResolverOptions{
+		Timeout:     2 * time.Second,
+		Retries:     2,
+		MaxFailures: 5,
+		DeadTimeout: 30 * time.Second,
+		DoHMethod:   http.MethodGet,
+	}
+}
+
+// Resolver resolves names by querying a pool of upstream DNS servers directly,
+// without going through the system resolver. It is safe for concurrent use.
+type Resolver struct {
+	opts    ResolverOptions
+	servers []*upstream
+	next    uint32
+}
+
+// IPRecord is an address returned by a Resolver along with its TTL in seconds.
+type IPRecord struct {
+	IP  net.IP `json:"ip"`
+	TTL uint32 `json:"ttl"`
+}
+
+// upstream holds the state kept for a single upstream server.
+type upstream struct {
+	addr     string
+	exchange exchangeFunc
+
+	mu        sync.Mutex
+	nextSlot  time.Time // earliest time the next query may be sent
+	failures  int
+	deadUntil time.Time
+}
+
+// NewResolver creates a Resolver for the given options. Servers given without a port use port 53.
+// The transport of each server is selected by its scheme: none or "udp://" for UDP with TCP fallback,
+// "tcp://" for TCP only, "tls://" for DNS-over-TLS (default port 853) and "https://" for DNS-over-HTTPS.
+func NewResolver(opts ResolverOptions) (*Resolver, error) {
+	opts = opts.withDefaults()
+	if len(opts.Servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers provided")
+	}
+
+	r := &Resolver{opts: opts}
+	for _, server := range opts.Servers {
+		s, err := newUpstream(server, opts)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, s)
+	}
+
+	return r, nil
+}
+
+// AliveServers returns the addresses of the servers that are not currently considered dead.
+func (r *Resolver) AliveServers() []string {
+	var alive []string
+	now := time.Now()
+	for _, s := range r.servers {
+		if !s.isDead(now) {
+			alive = append(alive, s.addr)
+		}
+	}
+	return alive
+}
+
+// LookupIP returns all IPv4 and IPv6 addresses of a host.
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]IPRecord, error) {
+	type result struct {
+		records []IPRecord
+		err     error
+	}
+
+	v6 := make(chan result, 1)
+	go func() {
+		records, err := r.LookupAAAA(ctx, host)
+		v6 <- result{records, err}
+	}()
+
+	records, err4 := r.LookupA(ctx, host)
+	res := <-v6
+	records = append(records, res.records...)
+
+	if len(records) == 0 {
+		if err4 != nil {
+			return nil, err4
+		}
+		if res.err != nil {
+			return nil, res.err
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+// LookupA returns the IPv4 addresses of a host.
+func (r *Resolver) LookupA(ctx context.Context, host string) ([]IPRecord, error) {
+	return r.lookupAddrs(ctx, host, dnsmessage.TypeA)
+}
+
+// LookupAAAA returns the IPv6 addresses of a host.
+func (r *Resolver) LookupAAAA(ctx context.Context, host string) ([]IPRecord, error) {
+	return r.lookupAddrs(ctx, host, dnsmessage.TypeAAAA)
+}
+
+func (r *Resolver) lookupAddrs(ctx context.Context, host string, qtype dnsmessage.Type) ([]IPRecord, error) {
+	msg, err := r.Exchange(ctx, host, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if err := rcodeError(msg, host); err != nil {
+		return nil, err
+	}
+
+	// Follow the CNAME chain so that only addresses belonging to host are returned.
+	names := map[string]bool{strings.ToLower(fqdn(host)): true}
+	var records []IPRecord
+	for changed := true; changed; {
+		changed = false
+		for _, rr := range msg.Answers {
+			owner := strings.ToLower(rr.Header.Name.String())
+			if !names[owner] {
+				continue
+			}
+			if cname, ok := rr.Body.(*dnsmessage.CNAMEResource); ok {
+				target := strings.ToLower(cname.CNAME.String())
+				if !names[target] {
+					names[target] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, rr := range msg.Answers {
+		if !names[strings.ToLower(rr.Header.Name.String())] {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			records = append(records, IPRecord{IP: net.IP(body.A[:]), TTL: rr.Header.TTL})
+		case *dnsmessage.AAAAResource:
+			records = append(records, IPRecord{IP: net.IP(body.AAAA[:]), TTL: rr.Header.TTL})
+		}
+	}
+
+	return records, nil
+}
+
+// Exchange sends a query for name and qtype to the upstream servers and returns the first usable response.
+// Servers are picked round-robin, skipping dead ones; SERVFAIL and REFUSED responses count as failures
+// and are retried on the next server. Other response codes, including NXDOMAIN, are returned as-is.
+// Queries interrupted because ctx is done are not counted against the server.
+func (r *Resolver) Exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, err := newQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= r.opts.Retries; attempt++ {
+		s := r.pick()
+		if err := s.wait(ctx, r.opts.RateLimit); err != nil {
+			return nil, err
+		}
+
+		resp, err := r.exchangeWith(ctx, s, query)
+		if err == nil && (resp.RCode == dnsmessage.RCodeServerFailure || resp.RCode == dnsmessage.RCodeRefused) {
+			err = fmt.Errorf("server %s responded with %s", s.addr, rcodeString(resp.RCode))
+		}
+		if err == nil {
+			s.succeeded()
+			return resp, nil
+		}
+
+		// A cancelled or expired caller context says nothing about the server.
+		if err := contextDone(ctx); err != nil {
+			return nil, err
+		}
+		s.failed(r.opts.MaxFailures, r.opts.DeadTimeout)
+		lastErr = err
+	}
+
+	return nil, &net.DNSError{Err: lastErr.Error(), Name: name, IsTemporary: true}
+}
+
+// pick returns the next server in round-robin order that is not dead.
+// If every server is dead, the one that will be revived first is returned.
+func (r *Resolver) pick() *upstream {
+	now := time.Now()
+	n := len(r.servers)
+	start := int(atomic.AddUint32(&r.next, 1)-1) % n
+
+	var fallback *upstream
+	for i := 0; i < n; i++ {
+		s := r.servers[(start+i)%n]
+		if !s.isDead(now) {
+			return s
+		}
+		if fallback == nil || s.revivesAt().Before(fallback.revivesAt()) {
+			fallback = s
+		}
+	}
+	return fallback
+}
+
+// exchangeWith queries a single server using its transport.
+func (r *Resolver) exchangeWith(ctx context.Context, s *upstream, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	return s.exchange(ctx, query)
+}
+
+// exchangeDNS queries a server over UDP, falling back to TCP if the response is truncated.
+func exchangeDNS(ctx context.Context, addr string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	resp, err := exchangeUDP(ctx, addr, query)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		return exchangeTCP(ctx, addr, query)
+	}
+	return resp, nil
+}
+
+func exchangeUDP(ctx context.Context, addr string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer setDeadline(ctx, conn)()
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := parseResponse(buf[:n], query)
+		if err != nil {
+			// Ignore stray or spoofed packets and keep waiting for the real response.
+			continue
+		}
+		return resp, nil
+	}
+}
+
+func exchangeTCP(ctx context.Context, addr string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer setDeadline(ctx, conn)()
+
+	return exchangeStream(conn, query)
+}
+
+// exchangeStream writes a length-prefixed query and reads its response.
+func exchangeStream(conn net.Conn, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+	buf, err := readTCPMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(buf, query)
+}
+
+// writeTCPMessage writes a length-prefixed DNS message, as used over TCP and TLS.
+func writeTCPMessage(w io.Writer, msg *dnsmessage.Message) error {
+	packed, err := msg.AppendPack(make([]byte, 2, 514))
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(packed, uint16(len(packed)-2))
+	_, err = w.Write(packed)
+	return err
+}
+
+// readTCPMessage reads a length-prefixed DNS message, as used over TCP and TLS.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseResponse unpacks a response and checks that it answers query.
+func parseResponse(buf []byte, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if !resp.Response || resp.ID != query.ID {
+		return nil, errors.New("response does not match query")
+	}
+	if len(resp.Questions) > 0 {
+		q, rq := query.Questions[0], resp.Questions[0]
+		if q.Type != rq.Type || q.Class != rq.Class || !strings.EqualFold(q.Name.String(), rq.Name.String()) {
+			return nil, errors.New("response question does not match query")
+		}
+	}
+	return &resp, nil
+}
+
+// newQuery builds a recursive query for name with an EDNS0 OPT record.
+func newQuery(name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	n, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS name %q: %v", name, err)
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(udpPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               binary.BigEndian.Uint16(id[:]),
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{
+			Name:  n,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+		Additionals: []dnsmessage.Resource{{
+			Header: opt,
+			Body:   &dnsmessage.OPTResource{},
+		}},
+	}, nil
+}
+
+// rcodeError converts a non-successful response code to a *net.DNSError.
+func rcodeError(msg *dnsmessage.Message, name string) error {
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+		return nil
+	case dnsmessage.RCodeNameError:
+		return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return &net.DNSError{Err: "server responded with " + rcodeString(msg.RCode), Name: name}
+	}
+}
+
+// fqdn returns name in its fully qualified, ASCII form.
+func fqdn(name string) string {
+	if ascii, err := toASCII(strings.TrimSuffix(name, ".")); err == nil {
+		name = ascii
+	}
+	return name + "."
+}
+
+// serverAddr appends port to a server address if it has none.
+func serverAddr(server, port string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+	host := strings.Trim(server, "[]")
+	if host == "" {
+		return "", fmt.Errorf("invalid DNS server address: %q", server)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// contextDone returns the error of ctx if it is done or past its deadline. The deadline is
+// checked as well because connection deadlines derived from it can expire before ctx is done.
+func contextDone(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// setDeadline applies the deadline of ctx to conn and interrupts conn if ctx is cancelled,
+// until the returned function is called.
+func setDeadline(ctx context.Context, conn net.Conn) (stop func()) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// wait blocks until the server's rate limit allows another query.
+func (s *upstream) wait(ctx context.Context, rate int) error {
+	if rate <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	slot := s.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	s.nextSlot = slot.Add(time.Second / time.Duration(rate))
+	s.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *upstream) succeeded() {
+	s.mu.Lock()
+	s.failures = 0
+	s.deadUntil = time.Time{}
+	s.mu.Unlock()
+}
+
+func (s *upstream) failed(maxFailures int, deadTimeout time.Duration) {
+	s.mu.Lock()
+	s.failures++
+	if s.failures >= maxFailures {
+		s.deadUntil = time.Now().Add(deadTimeout)
+	}
+	s.mu.Unlock()
+}
+
+func (s *upstream) isDead(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.deadUntil)
+}
+
+func (s *upstream) revivesAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadUntil
+}
+
+func (o ResolverOptions) withDefaults() ResolverOptions {
+	def := DefaultResolverOptions()
+	if o.Timeout <= 0 {
+		o.Timeout = def.Timeout
+	}
+	if o.Retries == 0 {
+		o.Retries = def.Retries
+	} else if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.MaxFailures <= 0 {
+		o.MaxFailures = def.MaxFailures
+	}
+	if o.DeadTimeout <= 0 {
+		o.DeadTimeout = def.DeadTimeout
+	}
+	if o.DoHMethod == "" {
+		o.DoHMethod = def.DoHMethod
+	}
+	return o
+}
@@ -0,0 +1,291 @@
+package domainutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubHandler answers a DNS query; tcp reports whether it arrived over TCP.
+type stubHandler func(q dnsmessage.Question, tcp bool) dnsmessage.Message
+
+// newStubServer starts an in-process DNS server answering over UDP and TCP on the same port.
+func newStubServer(t *testing.T, handler stubHandler) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up stub DNS server: %v", err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Fatalf("Failed to set up stub DNS server: %v", err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+
+	answer := func(buf []byte, tcp bool) []byte {
+		var query dnsmessage.Message
+		if err := query.Unpack(buf); err != nil || len(query.Questions) == 0 {
+			return nil
+		}
+		resp := handler(query.Questions[0], tcp)
+		resp.ID = query.ID
+		resp.Response = true
+		resp.Questions = query.Questions
+		packed, err := resp.Pack()
+		if err != nil {
+			t.Errorf("Failed to pack stub response: %v", err)
+			return nil
+		}
+		return packed
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if packed := answer(buf[:n], false); packed != nil {
+				pc.WriteTo(packed, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					buf, err := readTCPMessage(conn)
+					if err != nil {
+						return
+					}
+					packed := answer(buf, true)
+					if packed == nil {
+						return
+					}
+					conn.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...))
+				}
+			}()
+		}
+	}()
+
+	return pc.LocalAddr().String()
+}
+
+func rrHeader(name string, typ dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+		TTL:   ttl,
+	}
+}
+
+func exampleHandler(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+	var msg dnsmessage.Message
+	switch q.Name.String() {
+	case "www.example.com.":
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: rrHeader("www.example.com.", dnsmessage.TypeCNAME, 300),
+			Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")},
+		})
+		fallthrough
+	case "example.com.":
+		if q.Type == dnsmessage.TypeA {
+			msg.Answers = append(msg.Answers,
+				dnsmessage.Resource{Header: rrHeader("example.com.", dnsmessage.TypeA, 60), Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}},
+				dnsmessage.Resource{Header: rrHeader("example.com.", dnsmessage.TypeA, 60), Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 2}}},
+				// Unrelated records must not be returned.
+				dnsmessage.Resource{Header: rrHeader("other.com.", dnsmessage.TypeA, 60), Body: &dnsmessage.AResource{A: [4]byte{198, 51, 100, 1}}},
+			)
+		}
+		if q.Type == dnsmessage.TypeAAAA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: rrHeader("example.com.", dnsmessage.TypeAAAA, 120),
+				Body:   &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+			})
+		}
+	case "big.example.com.":
+		if !tcp {
+			msg.Truncated = true
+			break
+		}
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: rrHeader("big.example.com.", dnsmessage.TypeA, 30),
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 99}},
+		})
+	default:
+		msg.RCode = dnsmessage.RCodeNameError
+	}
+	return msg
+}
+
+func TestResolverLookupIP(t *testing.T) {
+	addr := newStubServer(t, exampleHandler)
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	records, err := r.LookupIP(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatalf("LookupIP failed: %v", err)
+	}
+
+	var got []string
+	for _, rec := range records {
+		got = append(got, rec.IP.String())
+		if rec.IP.To4() != nil && rec.TTL != 60 {
+			t.Errorf("Expected TTL 60 for %s, got %d", rec.IP, rec.TTL)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}
+	if len(got) != len(want) {
+		t.Fatalf("LookupIP returned %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("LookupIP returned %v; want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestResolverTCPFallback(t *testing.T) {
+	addr := newStubServer(t, exampleHandler)
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	records, err := r.LookupA(context.Background(), "big.example.com")
+	if err != nil {
+		t.Fatalf("LookupA failed: %v", err)
+	}
+	if len(records) != 1 || records[0].IP.String() != "192.0.2.99" {
+		t.Errorf("LookupA returned %v; want 192.0.2.99", records)
+	}
+}
+
+func TestResolverNXDomain(t *testing.T) {
+	addr := newStubServer(t, exampleHandler)
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	_, err = r.LookupIP(context.Background(), "missing.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestResolverDeadServer(t *testing.T) {
+	var failing int32
+	bad := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		atomic.AddInt32(&failing, 1)
+		return dnsmessage.Message{Header: dnsmessage.Header{RCode: dnsmessage.RCodeServerFailure}}
+	})
+	good := newStubServer(t, exampleHandler)
+
+	r, err := NewResolver(ResolverOptions{
+		Servers:     []string{bad, good},
+		MaxFailures: 1,
+		DeadTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.LookupA(context.Background(), "example.com"); err != nil {
+			t.Fatalf("LookupA failed: %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&failing); n != 1 {
+		t.Errorf("Expected failing server to be queried once, got %d", n)
+	}
+	if alive := r.AliveServers(); len(alive) != 1 || alive[0] != good {
+		t.Errorf("AliveServers() = %v; want [%s]", alive, good)
+	}
+}
+
+func TestResolverCancelledLookup(t *testing.T) {
+	slow := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		time.Sleep(200 * time.Millisecond)
+		return exampleHandler(q, tcp)
+	})
+	r, err := NewResolver(ResolverOptions{Servers: []string{slow}, MaxFailures: 1, DeadTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.LookupA(ctx, "example.com"); err == nil {
+		t.Fatalf("Expected LookupA to fail with an expired context")
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := r.LookupA(ctx, "example.com"); err == nil {
+		t.Fatalf("Expected LookupA to fail with a cancelled context")
+	}
+	if alive := r.AliveServers(); len(alive) != 1 {
+		t.Errorf("AliveServers() = %v; want the server to stay alive after cancelled lookups", alive)
+	}
+}
+
+func TestResolverRateLimit(t *testing.T) {
+	addr := newStubServer(t, exampleHandler)
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}, RateLimit: 20})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := r.LookupA(context.Background(), "example.com"); err != nil {
+			t.Fatalf("LookupA failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected 5 queries at 20/s to take at least 200ms, took %v", elapsed)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if _, err := NewResolver(ResolverOptions{}); err == nil {
+		t.Errorf("Expected error for resolver without servers")
+	}
+
+	r, err := NewResolver(ResolverOptions{Servers: []string{"192.0.2.53", "2001:db8::53", "[2001:db8::54]:5353"}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	want := []string{"192.0.2.53:53", "[2001:db8::53]:53", "[2001:db8::54]:5353"}
+	for i, addr := range r.AliveServers() {
+		if addr != want[i] {
+			t.Errorf("server %d = %s; want %s", i, addr, want[i])
+		}
+	}
+}
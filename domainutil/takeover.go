@@ -0,0 +1,173 @@
+package domainutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxTakeoverBody bounds how much of an HTTP response body is searched for fingerprints.
+const maxTakeoverBody = 1 << 20
+
+// TakeoverFingerprint describes a service whose unclaimed resources can be taken over
+// through a dangling CNAME record.
+type TakeoverFingerprint struct {
+	Service  string   `json:"service"`
+	CNAMEs   []string `json:"cnames"`             // glob patterns matched against CNAME targets, e.g. "*.github.io"
+	Body     []string `json:"body,omitempty"`     // strings found in the HTTP response of an unclaimed resource
+	NXDomain bool     `json:"nxdomain,omitempty"` // the service is vulnerable when the CNAME target does not resolve
+}
+
+// TakeoverResult is the outcome of a takeover check for a single host.
+type TakeoverResult struct {
+	Host       string   `json:"host"`
+	Chain      []string `json:"chain,omitempty"`    // CNAME targets, in order
+	Service    string   `json:"service,omitempty"`  // matched fingerprint, if any
+	Dangling   bool     `json:"dangling"`           // the end of the CNAME chain does not resolve
+	Vulnerable bool     `json:"vulnerable"`         // the fingerprint's takeover conditions are met
+	Confirmed  bool     `json:"confirmed"`          // an HTTP body fingerprint was found
+	Evidence   string   `json:"evidence,omitempty"` // the matched body fingerprint or "NXDOMAIN"
+}
+
+// TakeoverChecker follows CNAME chains and matches their targets against known vulnerable services.
+// It is safe for concurrent use.
+type TakeoverChecker struct {
+	resolver *Resolver
+	client   *http.Client
+
+	mu           sync.RWMutex
+	fingerprints []TakeoverFingerprint
+}
+
+// DefaultTakeoverFingerprints returns the bundled list of takeover fingerprints.
+func DefaultTakeoverFingerprints() []TakeoverFingerprint {
+	return []TakeoverFingerprint{
+		{Service: "AWS S3", CNAMEs: []string{"*.s3.amazonaws.com", "*.s3-*.amazonaws.com", "*.s3.*.amazonaws.com"}, Body: []string{"The specified bucket does not exist", "NoSuchBucket"}},
+		{Service: "AWS Elastic Beanstalk", CNAMEs: []string{"*.elasticbeanstalk.com"}, NXDomain: true},
+		{Service: "Microsoft Azure", CNAMEs: []string{
+			"*.azurewebsites.net", "*.cloudapp.net", "*.cloudapp.azure.com", "*.trafficmanager.net",
+			"*.blob.core.windows.net", "*.azure-api.net", "*.azureedge.net", "*.azurefd.net",
+			"*.azurecontainer.io", "*.azurehdinsight.net", "*.database.windows.net", "*.servicebus.windows.net",
+		}, NXDomain: true},
+		{Service: "GitHub Pages", CNAMEs: []string{"*.github.io"}, Body: []string{"There isn't a GitHub Pages site here."}},
+		{Service: "Heroku", CNAMEs: []string{"*.herokuapp.com", "*.herokudns.com"}, Body: []string{"No such app", "herokucdn.com/error-pages/no-such-app.html"}},
+		{Service: "Bitbucket", CNAMEs: []string{"*.bitbucket.io"}, Body: []string{"Repository not found"}},
+		{Service: "Fastly", CNAMEs: []string{"*.fastly.net"}, Body: []string{"Fastly error: unknown domain"}},
+		{Service: "Ghost", CNAMEs: []string{"*.ghost.io"}, Body: []string{"Failed to resolve DNS path for this host"}},
+		{Service: "Google Cloud Storage", CNAMEs: []string{"c.storage.googleapis.com"}, Body: []string{"NoSuchBucket"}},
+		{Service: "Netlify", CNAMEs: []string{"*.netlify.app", "*.netlify.com"}, Body: []string{"Not Found - Request ID"}},
+		{Service: "Pantheon", CNAMEs: []string{"*.pantheonsite.io"}, Body: []string{"The gods are wise, but do not know of the site which you seek."}},
+		{Service: "Readme.io", CNAMEs: []string{"*.readme.io"}, Body: []string{"Project doesnt exist... yet!"}},
+		{Service: "Shopify", CNAMEs: []string{"*.myshopify.com"}, Body: []string{"Sorry, this shop is currently unavailable."}},
+		{Service: "Surge.sh", CNAMEs: []string{"*.surge.sh"}, Body: []string{"project not found"}},
+		{Service: "Tumblr", CNAMEs: []string{"domains.tumblr.com"}, Body: []string{"Whatever you were looking for doesn't currently exist at this address"}},
+		{Service: "Unbounce", CNAMEs: []string{"unbouncepages.com", "*.unbouncepages.com"}, Body: []string{"The requested URL was not found on this server."}},
+		{Service: "Zendesk", CNAMEs: []string{"*.zendesk.com"}, Body: []string{"Help Center Closed"}},
+	}
+}
+
+// NewTakeoverChecker creates a TakeoverChecker using the bundled fingerprints.
+// If client is not nil, body fingerprints are confirmed by fetching the host over HTTPS and HTTP.
+func NewTakeoverChecker(r *Resolver, client *http.Client) *TakeoverChecker {
+	return &TakeoverChecker{
+		resolver:     r,
+		client:       client,
+		fingerprints: DefaultTakeoverFingerprints(),
+	}
+}
+
+// AddFingerprints extends the fingerprint list. Fingerprints added later take precedence.
+func (c *TakeoverChecker) AddFingerprints(fingerprints ...TakeoverFingerprint) {
+	c.mu.Lock()
+	c.fingerprints = append(append([]TakeoverFingerprint(nil), fingerprints...), c.fingerprints...)
+	c.mu.Unlock()
+}
+
+// Check follows the CNAME chain of host and reports whether it points at an unclaimed resource.
+func (c *TakeoverChecker) Check(ctx context.Context, host string) (*TakeoverResult, error) {
+	resp, err := c.resolver.Lookup(ctx, host, dnsmessage.TypeA)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TakeoverResult{Host: normalizeName(host)}
+	for _, rec := range CNAMEChain(host, resp.Answers) {
+		result.Chain = append(result.Chain, rec.Target)
+	}
+	if len(result.Chain) == 0 {
+		return result, responseError(resp, host)
+	}
+
+	// A recursive resolver reports the response code of the last name in the chain.
+	result.Dangling = resp.RCode == "NXDOMAIN"
+
+	fp := c.match(result.Chain)
+	if fp == nil {
+		return result, nil
+	}
+	result.Service = fp.Service
+
+	if fp.NXDomain && result.Dangling {
+		result.Vulnerable = true
+		result.Evidence = "NXDOMAIN"
+	}
+	if len(fp.Body) > 0 && c.client != nil {
+		if evidence := c.confirm(ctx, result.Host, fp.Body); evidence != "" {
+			result.Vulnerable = true
+			result.Confirmed = true
+			result.Evidence = evidence
+		}
+	}
+
+	return result, nil
+}
+
+// match returns the first fingerprint matching any target in the chain.
+func (c *TakeoverChecker) match(chain []string) *TakeoverFingerprint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := range c.fingerprints {
+		fp := &c.fingerprints[i]
+		for _, pattern := range fp.CNAMEs {
+			pattern = strings.ToLower(pattern)
+			for _, target := range chain {
+				if ok, _ := path.Match(pattern, target); ok {
+					return fp
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// confirm fetches host and returns the first body fingerprint found in the response.
+func (c *TakeoverChecker) confirm(ctx context.Context, host string, fingerprints []string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+host+"/", nil)
+		if err != nil {
+			return ""
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxTakeoverBody))
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, fingerprint := range fingerprints {
+			if strings.Contains(string(body), fingerprint) {
+				return fingerprint
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package domainutil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestTakeoverChecker(t *testing.T) {
+	cname := func(owner, target string) dnsmessage.Resource {
+		return dnsmessage.Resource{Header: rrHeader(owner, dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)}}
+	}
+	a := func(owner string) dnsmessage.Resource {
+		return dnsmessage.Resource{Header: rrHeader(owner, dnsmessage.TypeA, 60), Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}}
+	}
+
+	addr := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		var msg dnsmessage.Message
+		switch q.Name.String() {
+		case "blog.example.com.":
+			msg.Answers = []dnsmessage.Resource{cname("blog.example.com.", "example.github.io."), a("example.github.io.")}
+		case "docs.example.com.":
+			msg.Answers = []dnsmessage.Resource{cname("docs.example.com.", "claimed.github.io."), a("claimed.github.io.")}
+		case "old.example.com.":
+			msg.Answers = []dnsmessage.Resource{cname("old.example.com.", "gone.azurewebsites.net.")}
+			msg.RCode = dnsmessage.RCodeNameError
+		case "shop.example.com.":
+			msg.Answers = []dnsmessage.Resource{cname("shop.example.com.", "gone.example.net.")}
+			msg.RCode = dnsmessage.RCodeNameError
+		case "custom.example.com.":
+			msg.Answers = []dnsmessage.Resource{cname("custom.example.com.", "edge.example.org."), cname("edge.example.org.", "tenant.custom-cdn.test."), a("tenant.custom-cdn.test.")}
+		case "www.example.com.":
+			msg.Answers = []dnsmessage.Resource{a("www.example.com.")}
+		default:
+			msg.RCode = dnsmessage.RCodeNameError
+		}
+		return msg
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "blog.example.com":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<h1>404</h1><p>There isn't a GitHub Pages site here.</p>"))
+		case "custom.example.com":
+			w.Write([]byte("tenant not configured"))
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+
+	// Route every request to the test server, whatever the host.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	checker := NewTakeoverChecker(r, client)
+	checker.AddFingerprints(TakeoverFingerprint{Service: "Custom CDN", CNAMEs: []string{"*.custom-cdn.test"}, Body: []string{"tenant not configured"}})
+
+	tests := []struct {
+		host       string
+		service    string
+		dangling   bool
+		vulnerable bool
+		confirmed  bool
+	}{
+		{"blog.example.com", "GitHub Pages", false, true, true},
+		{"docs.example.com", "GitHub Pages", false, false, false},
+		{"old.example.com", "Microsoft Azure", true, true, false},
+		{"shop.example.com", "", true, false, false},
+		{"custom.example.com", "Custom CDN", false, true, true},
+		{"www.example.com", "", false, false, false},
+	}
+
+	for _, test := range tests {
+		result, err := checker.Check(context.Background(), test.host)
+		if err != nil {
+			t.Fatalf("Check(%s) failed: %v", test.host, err)
+		}
+		if result.Service != test.service || result.Dangling != test.dangling ||
+			result.Vulnerable != test.vulnerable || result.Confirmed != test.confirmed {
+			t.Errorf("Check(%s) = %+v; want service %q, dangling %v, vulnerable %v, confirmed %v",
+				test.host, result, test.service, test.dangling, test.vulnerable, test.confirmed)
+		}
+	}
+
+	if _, err := checker.Check(context.Background(), "missing.example.com"); err == nil {
+		t.Errorf("Expected error for missing host")
+	}
+}
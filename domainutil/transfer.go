@@ -0,0 +1,226 @@
+package domainutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// TypeIXFR is the query type of an incremental zone transfer.
+const TypeIXFR dnsmessage.Type = 251
+
+// ZoneTransferOptions configures ZoneTransfer.
+type ZoneTransferOptions struct {
+	Port    string        // port used to contact the name servers (default "53")
+	Timeout time.Duration // maximum time to wait for each message of a transfer (default 10s)
+}
+
+// ZoneTransferResult is the outcome of a zone transfer attempt against a single name server address.
+type ZoneTransferResult struct {
+	Server  string   `json:"server"`
+	Addr    string   `json:"addr"`
+	Records []Record `json:"records,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// ZoneTransfer discovers the name servers of zone and attempts an AXFR against every address of each of them.
+// One result is returned per address tried; servers that refuse the transfer have Error set.
+// An error is only returned if the name servers cannot be discovered.
+func (r *Resolver) ZoneTransfer(ctx context.Context, zone string, opts ZoneTransferOptions) ([]ZoneTransferResult, error) {
+	opts = opts.withDefaults()
+
+	nameservers, err := r.LookupNS(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if len(nameservers) == 0 {
+		return nil, &net.DNSError{Err: "no name servers found", Name: zone, IsNotFound: true}
+	}
+
+	var results []ZoneTransferResult
+	for _, ns := range nameservers {
+		addrs, err := r.LookupIP(ctx, ns.Target)
+		if err != nil {
+			results = append(results, ZoneTransferResult{Server: ns.Target, Error: err.Error()})
+			continue
+		}
+		for _, addr := range addrs {
+			results = append(results, ZoneTransferResult{Server: ns.Target, Addr: net.JoinHostPort(addr.IP.String(), opts.Port)})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Addr == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(res *ZoneTransferResult) {
+			defer wg.Done()
+			records, err := TransferZone(ctx, res.Addr, zone, opts.Timeout)
+			if err != nil {
+				res.Error = err.Error()
+				return
+			}
+			res.Records = records
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// TransferZone performs an AXFR of zone against the name server at addr ("host:port") over TCP
+// and returns every record of the zone, starting and ending with its SOA record.
+// timeout bounds the wait for each message; ctx bounds the whole transfer.
+func TransferZone(ctx context.Context, addr, zone string, timeout time.Duration) ([]Record, error) {
+	query, err := newTransferQuery(zone, dnsmessage.TypeAXFR, nil)
+	if err != nil {
+		return nil, err
+	}
+	return transfer(ctx, addr, query, timeout)
+}
+
+// TransferZoneIncremental performs an IXFR of zone against the name server at addr ("host:port") over TCP,
+// asking for the changes since serial. Records are returned as sent by the server: either the
+// incremental difference sequences of RFC 1995 or a full zone if the server falls back to AXFR.
+func TransferZoneIncremental(ctx context.Context, addr, zone string, serial uint32, timeout time.Duration) ([]Record, error) {
+	name, err := dnsmessage.NewName(fqdn(zone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone %q: %v", zone, err)
+	}
+	soa := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET},
+		Body:   &dnsmessage.SOAResource{NS: name, MBox: name, Serial: serial},
+	}
+
+	query, err := newTransferQuery(zone, TypeIXFR, &soa)
+	if err != nil {
+		return nil, err
+	}
+	return transfer(ctx, addr, query, timeout)
+}
+
+// transfer sends a transfer query and reads messages until the closing SOA record is received.
+func transfer(ctx context.Context, addr string, query *dnsmessage.Message, timeout time.Duration) ([]Record, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Unblock reads when ctx is cancelled.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+
+	ixfr := query.Questions[0].Type == TypeIXFR
+	var records []Record
+	var serial uint32
+	seen, want := 0, 2
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		buf, err := readTCPMessage(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		resp, err := parseResponse(buf, query)
+		if err != nil {
+			return nil, err
+		}
+		if resp.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("zone transfer refused by %s: %s", addr, rcodeString(resp.RCode))
+		}
+		if len(records) == 0 && (len(resp.Answers) == 0 || resp.Answers[0].Header.Type != dnsmessage.TypeSOA) {
+			return nil, errors.New("zone transfer did not start with a SOA record")
+		}
+
+		for _, rr := range resp.Answers {
+			rec := recordFromResource(rr)
+			records = append(records, rec)
+			if rec.SOA == nil {
+				continue
+			}
+			if len(records) == 1 {
+				serial = rec.SOA.Serial
+			} else if ixfr && len(records) == 2 {
+				// An incremental response repeats the current SOA before its last additions,
+				// so the transfer ends at its third occurrence rather than its second.
+				want = 3
+			}
+			if rec.SOA.Serial == serial {
+				seen++
+				if seen == want {
+					return records, nil
+				}
+			}
+		}
+
+		// An IXFR answered with only the current SOA means the zone is up to date.
+		if ixfr && len(records) == 1 {
+			return records, nil
+		}
+	}
+}
+
+// newTransferQuery builds a non-recursive AXFR or IXFR query.
+func newTransferQuery(zone string, qtype dnsmessage.Type, soa *dnsmessage.Resource) (*dnsmessage.Message, error) {
+	name, err := dnsmessage.NewName(fqdn(zone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone %q: %v", zone, err)
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	msg := &dnsmessage.Message{
+		Header: dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:])},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	if soa != nil {
+		msg.Authorities = []dnsmessage.Resource{*soa}
+	}
+	return msg, nil
+}
+
+func (o ZoneTransferOptions) withDefaults() ZoneTransferOptions {
+	if o.Port == "" {
+		o.Port = "53"
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	return o
+}
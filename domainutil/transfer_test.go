@@ -0,0 +1,188 @@
+package domainutil
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fixtureZone returns the records of example.com, starting and ending with its SOA.
+func fixtureZone() []dnsmessage.Resource {
+	soa := dnsmessage.Resource{
+		Header: rrHeader("example.com.", dnsmessage.TypeSOA, 3600),
+		Body: &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns1.example.com."),
+			MBox:   dnsmessage.MustNewName("hostmaster.example.com."),
+			Serial: 42, Refresh: 7200, Retry: 900, Expire: 1209600, MinTTL: 300,
+		},
+	}
+	return []dnsmessage.Resource{
+		soa,
+		{Header: rrHeader("example.com.", dnsmessage.TypeNS, 3600), Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns1.example.com.")}},
+		{Header: rrHeader("example.com.", dnsmessage.TypeMX, 3600), Body: &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")}},
+		{Header: rrHeader("www.example.com.", dnsmessage.TypeA, 300), Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}},
+		{Header: rrHeader("internal.example.com.", dnsmessage.TypeA, 300), Body: &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}}},
+		{Header: rrHeader("example.com.", dnsmessage.TypeTXT, 300), Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}}},
+		soa,
+	}
+}
+
+// newTransferServer serves fixtureZone over TCP, split across two messages.
+// IXFR queries are answered with the current SOA only, and queries for other zones are refused.
+func newTransferServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up transfer server: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				var query dnsmessage.Message
+				if err := query.Unpack(buf); err != nil {
+					return
+				}
+
+				header := dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true}
+				zone := fixtureZone()
+				if query.Questions[0].Name.String() == "example.com." && query.Questions[0].Type == TypeIXFR {
+					writeTCPMessage(conn, &dnsmessage.Message{Header: header, Questions: query.Questions, Answers: zone[:1]})
+					return
+				}
+				if query.Questions[0].Name.String() != "example.com." || query.Questions[0].Type != dnsmessage.TypeAXFR {
+					header.RCode = dnsmessage.RCodeRefused
+					writeTCPMessage(conn, &dnsmessage.Message{Header: header, Questions: query.Questions})
+					return
+				}
+
+				writeTCPMessage(conn, &dnsmessage.Message{Header: header, Questions: query.Questions, Answers: zone[:3]})
+				writeTCPMessage(conn, &dnsmessage.Message{Header: header, Answers: zone[3:]})
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestTransferZone(t *testing.T) {
+	addr := newTransferServer(t)
+
+	records, err := TransferZone(context.Background(), addr, "example.com", time.Second)
+	if err != nil {
+		t.Fatalf("TransferZone failed: %v", err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("TransferZone returned %d records; want 7", len(records))
+	}
+	if records[0].Type != "SOA" || records[6].Type != "SOA" || records[0].SOA.Serial != 42 {
+		t.Errorf("Expected transfer to start and end with SOA, got %+v", records)
+	}
+	if records[4].Name != "internal.example.com" || records[4].Data != "10.0.0.1" {
+		t.Errorf("Unexpected record %+v", records[4])
+	}
+
+	if _, err := TransferZone(context.Background(), addr, "example.org", time.Second); err == nil {
+		t.Errorf("Expected refused transfer to fail")
+	}
+}
+
+func TestTransferZoneIncremental(t *testing.T) {
+	addr := newTransferServer(t)
+
+	records, err := TransferZoneIncremental(context.Background(), addr, "example.com", 42, time.Second)
+	if err != nil {
+		t.Fatalf("TransferZoneIncremental failed: %v", err)
+	}
+	if len(records) != 1 || records[0].SOA == nil || records[0].SOA.Serial != 42 {
+		t.Errorf("TransferZoneIncremental = %+v; want the current SOA only", records)
+	}
+}
+
+func TestTransferZoneContext(t *testing.T) {
+	// A server that accepts but never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up server: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := TransferZone(ctx, ln.Addr().String(), "example.com", 10*time.Second); err == nil {
+		t.Errorf("Expected error when context expires")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TransferZone did not honor the context, took %v", elapsed)
+	}
+}
+
+func TestZoneTransfer(t *testing.T) {
+	transferAddr := newTransferServer(t)
+	_, port, _ := net.SplitHostPort(transferAddr)
+
+	dnsAddr := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		var msg dnsmessage.Message
+		switch {
+		case q.Name.String() == "example.com." && q.Type == dnsmessage.TypeNS:
+			for _, ns := range []string{"ns1.example.com.", "ns2.example.com."} {
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader("example.com.", dnsmessage.TypeNS, 3600), Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName(ns)}})
+			}
+		case q.Name.String() == "ns1.example.com." && q.Type == dnsmessage.TypeA:
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader("ns1.example.com.", dnsmessage.TypeA, 3600), Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}})
+		case q.Name.String() == "ns2.example.com." && q.Type == dnsmessage.TypeA:
+			// Nothing listens on this address.
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader("ns2.example.com.", dnsmessage.TypeA, 3600), Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}}})
+		}
+		return msg
+	})
+
+	r, err := NewResolver(ResolverOptions{Servers: []string{dnsAddr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	results, err := r.ZoneTransfer(context.Background(), "example.com", ZoneTransferOptions{Port: port, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("ZoneTransfer failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("ZoneTransfer returned %d results; want 2", len(results))
+	}
+
+	for _, res := range results {
+		switch res.Server {
+		case "ns1.example.com":
+			if res.Error != "" || len(res.Records) != 7 || res.Addr != "127.0.0.1:"+port {
+				t.Errorf("Unexpected result for ns1: %+v", res)
+			}
+		case "ns2.example.com":
+			if res.Error == "" || len(res.Records) != 0 {
+				t.Errorf("Expected ns2 transfer to fail, got %+v", res)
+			}
+		default:
+			t.Errorf("Unexpected server %s", res.Server)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package domainutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohContentType is the media type of DNS wire format messages sent over HTTPS (RFC 8484).
+const dohContentType = "application/dns-message"
+
+// maxIdleTLSConns is the number of idle DNS-over-TLS connections kept per server.
+const maxIdleTLSConns = 4
+
+// exchangeFunc sends a query to a single server and returns its response.
+type exchangeFunc func(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error)
+
+// newUpstream creates the upstream for a server, selecting its transport from the scheme of the address.
+func newUpstream(server string, opts ResolverOptions) (*upstream, error) {
+	scheme, rest, ok := strings.Cut(server, "://")
+	if !ok {
+		scheme, rest = "udp", server
+	}
+
+	switch strings.ToLower(scheme) {
+	case "udp":
+		addr, err := serverAddr(rest, "53")
+		if err != nil {
+			return nil, err
+		}
+		return &upstream{addr: addr, exchange: func(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+			return exchangeDNS(ctx, addr, query)
+		}}, nil
+
+	case "tcp":
+		addr, err := serverAddr(rest, "53")
+		if err != nil {
+			return nil, err
+		}
+		return &upstream{addr: "tcp://" + addr, exchange: func(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+			return exchangeTCP(ctx, addr, query)
+		}}, nil
+
+	case "tls":
+		addr, err := serverAddr(rest, "853")
+		if err != nil {
+			return nil, err
+		}
+		t := newTLSTransport(addr, opts.TLSConfig)
+		return &upstream{addr: "tls://" + addr, exchange: t.exchange}, nil
+
+	case "https":
+		endpoint, err := url.Parse(server)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid DNS-over-HTTPS URL: %q", server)
+		}
+		method := strings.ToUpper(opts.DoHMethod)
+		if method != http.MethodGet && method != http.MethodPost {
+			return nil, fmt.Errorf("unsupported DNS-over-HTTPS method: %q", opts.DoHMethod)
+		}
+		client := opts.HTTPClient
+		if client == nil {
+			client = newDoHClient(opts.TLSConfig)
+		}
+		return &upstream{addr: endpoint.String(), exchange: func(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+			return exchangeHTTPS(ctx, client, endpoint, method, query)
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported DNS server scheme: %q", server)
+	}
+}
+
+// exchangeHTTPS sends a query to a DNS-over-HTTPS endpoint using the GET or POST wire format of RFC 8484.
+func exchangeHTTPS(ctx context.Context, client *http.Client, endpoint *url.URL, method string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	// RFC 8484 recommends an ID of 0 so that responses can be cached by HTTP caches.
+	q := *query
+	q.ID = 0
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if method == http.MethodGet {
+		u := *endpoint
+		values := u.Query()
+		values.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+		u.RawQuery = values.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(packed))
+		if req != nil {
+			req.Header.Set("Content-Type", dohContentType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dohContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server %s responded with HTTP %s", endpoint, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != dohContentType {
+		return nil, fmt.Errorf("server %s responded with unexpected content type %q", endpoint, resp.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65536))
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(body, &q)
+}
+
+// newDoHClient returns the HTTP client used for DNS-over-HTTPS when none is configured.
+func newDoHClient(config *tls.Config) *http.Client {
+	if config != nil {
+		config = config.Clone()
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     config,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// tlsTransport sends queries to a DNS-over-TLS server (RFC 7858), reusing idle connections.
+type tlsTransport struct {
+	addr   string
+	config *tls.Config
+	idle   chan *tls.Conn
+}
+
+func newTLSTransport(addr string, config *tls.Config) *tlsTransport {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, _ := net.SplitHostPort(addr)
+		config.ServerName = host
+	}
+	return &tlsTransport{addr: addr, config: config, idle: make(chan *tls.Conn, maxIdleTLSConns)}
+}
+
+func (t *tlsTransport) exchange(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	select {
+	case conn := <-t.idle:
+		resp, err := t.exchangeConn(ctx, conn, query)
+		if err == nil || ctx.Err() != nil {
+			return resp, err
+		}
+		// The server may have closed the idle connection; retry on a new one.
+	default:
+	}
+
+	d := tls.Dialer{Config: t.config}
+	conn, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.exchangeConn(ctx, conn.(*tls.Conn), query)
+}
+
+// exchangeConn sends a query on conn and returns it to the idle pool on success.
+func (t *tlsTransport) exchangeConn(ctx context.Context, conn *tls.Conn, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	conn.SetDeadline(time.Time{})
+	stop := setDeadline(ctx, conn)
+	resp, err := exchangeStream(conn, query)
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case t.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return resp, nil
+}
@@ -0,0 +1,198 @@
+package domainutil
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubAnswer answers a packed query using handler, as newStubServer does.
+func stubAnswer(t *testing.T, buf []byte, handler stubHandler) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(buf); err != nil || len(query.Questions) == 0 {
+		return nil
+	}
+	resp := handler(query.Questions[0], true)
+	resp.ID = query.ID
+	resp.Response = true
+	resp.Questions = query.Questions
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Errorf("Failed to pack stub response: %v", err)
+		return nil
+	}
+	return packed
+}
+
+func TestResolverDoH(t *testing.T) {
+	var gets, posts int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf []byte
+		switch r.Method {
+		case http.MethodGet:
+			atomic.AddInt32(&gets, 1)
+			buf, _ = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		case http.MethodPost:
+			atomic.AddInt32(&posts, 1)
+			if r.Header.Get("Content-Type") != dohContentType {
+				http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+				return
+			}
+			buf, _ = io.ReadAll(r.Body)
+		}
+		packed := stubAnswer(t, buf, exampleHandler)
+		if packed == nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}))
+	defer server.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		r, err := NewResolver(ResolverOptions{
+			Servers:    []string{server.URL + "/dns-query"},
+			DoHMethod:  method,
+			HTTPClient: server.Client(),
+		})
+		if err != nil {
+			t.Fatalf("NewResolver failed: %v", err)
+		}
+
+		records, err := r.LookupA(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatalf("LookupA over DoH %s failed: %v", method, err)
+		}
+		if len(records) != 2 || records[0].IP.String() != "192.0.2.1" {
+			t.Errorf("LookupA over DoH %s = %v; want 192.0.2.1 and 192.0.2.2", method, records)
+		}
+
+		if _, err := r.LookupA(context.Background(), "missing.example.com"); !isNotFound(err) {
+			t.Errorf("Expected not found error over DoH %s, got %v", method, err)
+		}
+	}
+
+	if gets == 0 || posts == 0 {
+		t.Errorf("Expected both GET and POST requests, got %d GET and %d POST", gets, posts)
+	}
+}
+
+func TestResolverDoHError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>not a DNS server</html>"))
+	}))
+	defer server.Close()
+
+	r, err := NewResolver(ResolverOptions{Servers: []string{server.URL}, HTTPClient: server.Client(), Retries: -1})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	if _, err := r.LookupA(context.Background(), "example.com"); err == nil {
+		t.Errorf("Expected error for non-DNS response")
+	}
+}
+
+func TestResolverDoT(t *testing.T) {
+	// Borrow the certificate and client configuration of an httptest TLS server.
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("Failed to set up DoT server: %v", err)
+	}
+	defer ln.Close()
+
+	var conns int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					buf, err := readTCPMessage(conn)
+					if err != nil {
+						return
+					}
+					packed := stubAnswer(t, buf, exampleHandler)
+					if packed == nil {
+						return
+					}
+					conn.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...))
+				}
+			}(conn)
+		}
+	}()
+
+	clientConfig := certServer.Client().Transport.(*http.Transport).TLSClientConfig
+	r, err := NewResolver(ResolverOptions{Servers: []string{"tls://" + ln.Addr().String()}, TLSConfig: clientConfig})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		records, err := r.LookupA(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("LookupA over DoT failed: %v", err)
+		}
+		if len(records) != 2 {
+			t.Errorf("LookupA over DoT returned %d records; want 2", len(records))
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("Expected DoT connection to be reused, got %d connections", n)
+	}
+
+	// The certificate is not trusted without the test configuration.
+	untrusted, err := NewResolver(ResolverOptions{Servers: []string{"tls://" + ln.Addr().String()}, Retries: -1})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	if _, err := untrusted.LookupA(context.Background(), "example.com"); err == nil {
+		t.Errorf("Expected certificate verification error")
+	}
+}
+
+func TestNewResolverTransports(t *testing.T) {
+	r, err := NewResolver(ResolverOptions{Servers: []string{
+		"udp://192.0.2.53", "tcp://192.0.2.53", "tls://1.1.1.1", "tls://[2001:db8::53]:8853", "https://dns.example/dns-query",
+	}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	want := []string{"192.0.2.53:53", "tcp://192.0.2.53:53", "tls://1.1.1.1:853", "tls://[2001:db8::53]:8853", "https://dns.example/dns-query"}
+	for i, addr := range r.AliveServers() {
+		if addr != want[i] {
+			t.Errorf("server %d = %s; want %s", i, addr, want[i])
+		}
+	}
+
+	invalid := []ResolverOptions{
+		{Servers: []string{"quic://dns.example"}},
+		{Servers: []string{"https://"}},
+		{Servers: []string{"https://dns.example/dns-query"}, DoHMethod: "PUT"},
+	}
+	for _, opts := range invalid {
+		if _, err := NewResolver(opts); err == nil {
+			t.Errorf("NewResolver(%v) succeeded; want error", opts.Servers)
+		}
+	}
+}
+
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
@@ -0,0 +1,214 @@
+package domainutil
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DomainTree groups hostnames label by label under their root domains.
+type DomainTree struct {
+	Roots []*DomainNode `json:"roots"` // root domains (eTLD+1), sorted by name
+	Hosts int           `json:"hosts"` // number of unique hostnames in the tree
+
+	hosts []string
+}
+
+// DomainNode is a zone or hostname in a DomainTree.
+type DomainNode struct {
+	Name     string        `json:"name"`               // full name, e.g. "api.dev.example.com"
+	Label    string        `json:"label"`              // leftmost label, or the full name for root domains
+	Host     bool          `json:"host"`               // the name itself was in the input
+	Count    int           `json:"count"`              // input hostnames at or below this node
+	Children []*DomainNode `json:"children,omitempty"` // sorted by label
+}
+
+// BuildDomainTree builds a DomainTree from a list of hostnames. Names are lowercased and
+// deduplicated, and empty names are skipped. Names without a registrable domain, such as
+// "localhost", become root nodes of their own.
+func BuildDomainTree(hosts []string) *DomainTree {
+	t := &DomainTree{}
+	roots := make(map[string]*DomainNode)
+	nodes := make(map[string]*DomainNode)
+
+	for _, host := range hosts {
+		host = normalizeName(strings.TrimSpace(host))
+		if host == "" || nodes[host] != nil && nodes[host].Host {
+			continue
+		}
+		t.hosts = append(t.hosts, host)
+
+		root, err := RegistrableDomain(host)
+		if err != nil || !strings.HasSuffix(host, root) {
+			root = host
+		}
+		node, ok := roots[root]
+		if !ok {
+			node = &DomainNode{Name: root, Label: root}
+			roots[root] = node
+			nodes[root] = node
+			t.Roots = append(t.Roots, node)
+		}
+		node.Count++
+
+		if rest := strings.TrimSuffix(strings.TrimSuffix(host, root), "."); rest != "" {
+			labels := strings.Split(rest, ".")
+			for i := len(labels) - 1; i >= 0; i-- {
+				name := labels[i] + "." + node.Name
+				child, ok := nodes[name]
+				if !ok {
+					child = &DomainNode{Name: name, Label: labels[i]}
+					nodes[name] = child
+					node.Children = append(node.Children, child)
+				}
+				child.Count++
+				node = child
+			}
+		}
+		node.Host = true
+	}
+
+	t.Hosts = len(t.hosts)
+	sort.Slice(t.Roots, func(i, j int) bool { return t.Roots[i].Name < t.Roots[j].Name })
+	for _, root := range t.Roots {
+		root.sortChildren()
+	}
+	return t
+}
+
+// Find returns the node for name, or nil if the tree does not contain it.
+func (t *DomainTree) Find(name string) *DomainNode {
+	name = normalizeName(name)
+	for _, root := range t.Roots {
+		if name != root.Name && !strings.HasSuffix(name, "."+root.Name) {
+			continue
+		}
+		node := root
+		for node.Name != name {
+			next := node.child(name)
+			if next == nil {
+				return nil
+			}
+			node = next
+		}
+		return node
+	}
+	return nil
+}
+
+// LevelCounts returns the number of names at each depth of the tree, starting with
+// the number of root domains.
+func (t *DomainTree) LevelCounts() []int {
+	var counts []int
+	var walk func(n *DomainNode, depth int)
+	walk = func(n *DomainNode, depth int) {
+		if depth == len(counts) {
+			counts = append(counts, 0)
+		}
+		counts[depth]++
+		for _, child := range n.Children {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range t.Roots {
+		walk(root, 0)
+	}
+	return counts
+}
+
+// DeepestCommonZone returns the deepest zone that contains every hostname in the tree, or ""
+// if the hostnames only share a public suffix.
+func (t *DomainTree) DeepestCommonZone() string {
+	return DeepestCommonZone(t.hosts)
+}
+
+// WriteText renders the tree in the style of the tree command. Nodes with children
+// show how many input hostnames they contain.
+func (t *DomainTree) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, root := range t.Roots {
+		b.WriteString(root.Name)
+		writeCount(&b, root)
+		b.WriteByte('\n')
+		writeChildren(&b, root, "")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String returns the text rendering of the tree.
+func (t *DomainTree) String() string {
+	var b strings.Builder
+	t.WriteText(&b)
+	return b.String()
+}
+
+// DeepestCommonZone returns the longest label-wise suffix shared by all hosts,
+// e.g. "dev.example.com" for "a.dev.example.com" and "b.dev.example.com". It returns ""
+// if there is none or if it is a public suffix, e.g. for "example.com" and "example2.com".
+func DeepestCommonZone(hosts []string) string {
+	var common []string
+	first := true
+	for _, host := range hosts {
+		host = normalizeName(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		labels := strings.Split(host, ".")
+		if first {
+			common, first = labels, false
+			continue
+		}
+
+		n := 0
+		for n < len(common) && n < len(labels) && common[len(common)-1-n] == labels[len(labels)-1-n] {
+			n++
+		}
+		common = common[len(common)-n:]
+		if len(common) == 0 {
+			break
+		}
+	}
+
+	zone := strings.Join(common, ".")
+	if zone == PublicSuffix(zone) {
+		return ""
+	}
+	return zone
+}
+
+func (n *DomainNode) child(name string) *DomainNode {
+	for _, c := range n.Children {
+		if name == c.Name || strings.HasSuffix(name, "."+c.Name) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *DomainNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Label < n.Children[j].Label })
+	for _, c := range n.Children {
+		c.sortChildren()
+	}
+}
+
+func writeChildren(b *strings.Builder, n *DomainNode, prefix string) {
+	for i, c := range n.Children {
+		branch, indent := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		b.WriteString(prefix + branch + c.Label)
+		writeCount(b, c)
+		b.WriteByte('\n')
+		writeChildren(b, c, prefix+indent)
+	}
+}
+
+func writeCount(b *strings.Builder, n *DomainNode) {
+	if len(n.Children) > 0 {
+		fmt.Fprintf(b, " (%d)", n.Count)
+	}
+}
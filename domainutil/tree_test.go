@@ -0,0 +1,96 @@
+package domainutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBuildDomainTree(t *testing.T) {
+	tree := BuildDomainTree([]string{
+		"www.example.com",
+		"api.dev.example.com",
+		"WEB.dev.example.com.",
+		"dev.example.com",
+		"www.example.com",
+		"shop.example.co.uk",
+		"localhost",
+		"",
+	})
+
+	if tree.Hosts != 6 {
+		t.Errorf("Hosts = %d; want 6", tree.Hosts)
+	}
+
+	var roots []string
+	for _, root := range tree.Roots {
+		roots = append(roots, root.Name)
+	}
+	if want := []string{"example.co.uk", "example.com", "localhost"}; !reflect.DeepEqual(roots, want) {
+		t.Errorf("Roots = %v; want %v", roots, want)
+	}
+
+	dev := tree.Find("dev.example.com")
+	if dev == nil || !dev.Host || dev.Count != 3 || len(dev.Children) != 2 || dev.Children[0].Label != "api" {
+		t.Errorf("Unexpected node for dev.example.com: %+v", dev)
+	}
+	if root := tree.Find("example.com"); root == nil || root.Host || root.Count != 4 {
+		t.Errorf("Unexpected node for example.com: %+v", root)
+	}
+	if tree.Find("missing.example.com") != nil {
+		t.Errorf("Expected no node for missing.example.com")
+	}
+
+	if got, want := tree.LevelCounts(), []int{3, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LevelCounts() = %v; want %v", got, want)
+	}
+
+	wantText := `example.co.uk (1)
+└── shop
+example.com (4)
+├── dev (3)
+│   ├── api
+│   └── web
+└── www
+localhost
+`
+	if got := tree.String(); got != wantText {
+		t.Errorf("String() = \n%s\nwant\n%s", got, wantText)
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	var decoded DomainTree
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Roots) != 3 || decoded.Roots[1].Children[0].Name != "dev.example.com" {
+		t.Errorf("Unexpected JSON rendering %s", data)
+	}
+}
+
+func TestDeepestCommonZone(t *testing.T) {
+	tests := []struct {
+		hosts []string
+		want  string
+	}{
+		{[]string{"a.dev.example.com", "b.dev.example.com"}, "dev.example.com"},
+		{[]string{"dev.example.com", "a.dev.example.com"}, "dev.example.com"},
+		{[]string{"www.example.com", "api.dev.example.com"}, "example.com"},
+		{[]string{"example.com", "example2.com"}, ""},
+		{[]string{"shop.example.co.uk", "example2.co.uk"}, ""},
+		{[]string{"a.example.co.uk", "b.example.co.uk"}, "example.co.uk"},
+		{[]string{"example.com", "example.org"}, ""},
+		{[]string{"www.example.com"}, "www.example.com"},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		if got := DeepestCommonZone(test.hosts); got != test.want {
+			t.Errorf("DeepestCommonZone(%v) = %q; want %q", test.hosts, got, test.want)
+		}
+	}
+
+	if got := BuildDomainTree([]string{"a.dev.example.com", "b.dev.example.com"}).DeepestCommonZone(); got != "dev.example.com" {
+		t.Errorf("DomainTree.DeepestCommonZone() = %q; want dev.example.com", got)
+	}
+}
@@ -0,0 +1,216 @@
+package domainutil
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Technique names the method used to derive a lookalike domain.
+type Technique string
+
+// Typosquatting techniques.
+const (
+	Bitsquatting       Technique = "bitsquatting"
+	Homoglyph          Technique = "homoglyph"
+	Omission           Technique = "omission"
+	Repetition         Technique = "repetition"
+	Transposition      Technique = "transposition"
+	VowelSwap          Technique = "vowel-swap"
+	Hyphenation        Technique = "hyphenation"
+	TLDSwap            Technique = "tld-swap"
+	SubdomainInsertion Technique = "subdomain-insertion"
+)
+
+// Typosquat is a lookalike domain generated from a legitimate one.
+type Typosquat struct {
+	Domain    string    `json:"domain"`            // ASCII form, with IDN labels in punycode
+	Unicode   string    `json:"unicode,omitempty"` // Unicode form of IDN lookalikes
+	Technique Technique `json:"technique"`
+}
+
+// TyposquatOptions controls GenerateTyposquats.
+type TyposquatOptions struct {
+	Techniques []Technique // techniques to apply, in order (default AllTechniques())
+	TLDs       []string    // TLDs used for TLD swapping (default DefaultTyposquatTLDs())
+}
+
+// AllTechniques returns every typosquatting technique.
+func AllTechniques() []Technique {
+	return []Technique{
+		Bitsquatting, Homoglyph, Omission, Repetition, Transposition,
+		VowelSwap, Hyphenation, TLDSwap, SubdomainInsertion,
+	}
+}
+
+// DefaultTyposquatTLDs returns popular TLDs used for TLD swapping.
+func DefaultTyposquatTLDs() []string {
+	return []string{
+		"com", "net", "org", "info", "biz", "co", "io", "app", "dev", "xyz", "online", "site",
+		"shop", "us", "uk", "co.uk", "de", "eu", "cn", "ru",
+	}
+}
+
+// homoglyphs maps characters to lookalike replacements, ASCII ones first.
+var homoglyphs = map[rune][]string{
+	'a': {"4", "à", "á", "â", "ã", "ä", "å", "ɑ", "а"},
+	'b': {"d", "lb", "ḃ", "ḅ", "ь"},
+	'c': {"e", "ç", "ć", "ċ", "с"},
+	'd': {"b", "cl", "dl", "ď", "đ", "ԁ"},
+	'e': {"c", "3", "è", "é", "ê", "ë", "ė", "е"},
+	'f': {"ƒ", "ḟ"},
+	'g': {"q", "9", "ɡ", "ġ", "ğ"},
+	'h': {"lh", "ḥ", "һ"},
+	'i': {"1", "l", "í", "ì", "ï", "ı", "і"},
+	'j': {"ј", "ʝ"},
+	'k': {"lk", "ik", "lc", "ḳ", "κ"},
+	'l': {"1", "i", "ł", "ĺ", "ӏ"},
+	'm': {"n", "nn", "rn", "rr", "ṃ", "м"},
+	'n': {"m", "r", "ń", "ñ", "ņ", "п"},
+	'o': {"0", "ò", "ó", "ô", "õ", "ö", "ø", "о", "ο"},
+	'p': {"ρ", "р", "ṗ"},
+	'q': {"g", "ԛ"},
+	'r': {"ŕ", "ř", "ɾ", "г"},
+	's': {"5", "ś", "ş", "š", "ѕ"},
+	't': {"ţ", "ť", "ṫ", "τ"},
+	'u': {"μ", "ù", "ú", "û", "ü", "υ"},
+	'v': {"ѵ", "ν", "ṿ"},
+	'w': {"vv", "ŵ", "ẁ", "ẃ", "ẅ", "ԝ"},
+	'x': {"ẋ", "х"},
+	'y': {"ý", "ÿ", "ŷ", "у"},
+	'z': {"2", "ź", "ż", "ž", "ᴢ"},
+	'0': {"o"},
+	'1': {"l", "i"},
+	'5': {"s"},
+}
+
+// GenerateTyposquats returns dnstwist-style lookalikes of the registrable domain of domain,
+// e.g. "examp1e.com" or "exampel.com" for "www.example.com". Each variant is tagged with the
+// first technique that produced it; variants are deduplicated, exclude the original and are
+// valid according to IsValidDomain once converted to their ASCII form.
+func GenerateTyposquats(domain string, opts TyposquatOptions) ([]Typosquat, error) {
+	opts = opts.withDefaults()
+
+	root, err := RegistrableDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	suffix := PublicSuffix(root)
+	name := strings.TrimSuffix(root, "."+suffix)
+
+	seen := map[string]bool{root: true}
+	var results []Typosquat
+	add := func(technique Technique, candidate string) {
+		ascii, err := toASCII(candidate)
+		if err != nil || seen[ascii] || !IsValidDomain(ascii) {
+			return
+		}
+		seen[ascii] = true
+		t := Typosquat{Domain: ascii, Technique: technique}
+		if ascii != candidate {
+			t.Unicode = candidate
+		}
+		results = append(results, t)
+	}
+
+	for _, technique := range opts.Techniques {
+		if technique == TLDSwap {
+			for _, tld := range opts.TLDs {
+				add(technique, name+"."+strings.ToLower(strings.Trim(tld, ".")))
+			}
+			continue
+		}
+
+		variants, err := typoVariants(technique, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			add(technique, variant+"."+suffix)
+		}
+	}
+
+	return results, nil
+}
+
+// typoVariants applies a label-level technique to name.
+func typoVariants(technique Technique, name string) ([]string, error) {
+	var variants []string
+	switch technique {
+	case Bitsquatting:
+		for i := 0; i < len(name); i++ {
+			for bit := 0; bit < 8; bit++ {
+				if c := name[i] ^ (1 << bit); isLabelChar(c) {
+					variants = append(variants, name[:i]+string(c)+name[i+1:])
+				}
+			}
+		}
+
+	case Homoglyph:
+		for i, r := range name {
+			for _, glyph := range homoglyphs[r] {
+				variants = append(variants, name[:i]+glyph+name[i+utf8.RuneLen(r):])
+			}
+		}
+
+	case Omission:
+		for i := 0; i < len(name); i++ {
+			variants = append(variants, name[:i]+name[i+1:])
+		}
+
+	case Repetition:
+		for i := 0; i < len(name); i++ {
+			variants = append(variants, name[:i+1]+name[i:])
+		}
+
+	case Transposition:
+		for i := 0; i+1 < len(name); i++ {
+			if name[i] != name[i+1] {
+				variants = append(variants, name[:i]+string(name[i+1])+string(name[i])+name[i+2:])
+			}
+		}
+
+	case VowelSwap:
+		const vowels = "aeiou"
+		for i := 0; i < len(name); i++ {
+			if !strings.ContainsRune(vowels, rune(name[i])) {
+				continue
+			}
+			for _, v := range vowels {
+				if byte(v) != name[i] {
+					variants = append(variants, name[:i]+string(v)+name[i+1:])
+				}
+			}
+		}
+
+	case Hyphenation:
+		for i := 1; i < len(name); i++ {
+			variants = append(variants, name[:i]+"-"+name[i:])
+		}
+
+	case SubdomainInsertion:
+		for i := 1; i < len(name); i++ {
+			if name[i] != '-' && name[i-1] != '-' {
+				variants = append(variants, name[:i]+"."+name[i:])
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown typosquatting technique: %q", technique)
+	}
+	return variants, nil
+}
+
+func isLabelChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
+
+func (o TyposquatOptions) withDefaults() TyposquatOptions {
+	if o.Techniques == nil {
+		o.Techniques = AllTechniques()
+	}
+	if o.TLDs == nil {
+		o.TLDs = DefaultTyposquatTLDs()
+	}
+	return o
+}
@@ -0,0 +1,81 @@
+package domainutil
+
+import (
+	"testing"
+)
+
+func TestGenerateTyposquats(t *testing.T) {
+	results, err := GenerateTyposquats("www.example.com", TyposquatOptions{})
+	if err != nil {
+		t.Fatalf("GenerateTyposquats failed: %v", err)
+	}
+
+	found := make(map[string]Typosquat)
+	for _, r := range results {
+		if _, dup := found[r.Domain]; dup {
+			t.Errorf("Duplicate variant %s", r.Domain)
+		}
+		if !IsValidDomain(r.Domain) {
+			t.Errorf("Invalid variant %s", r.Domain)
+		}
+		found[r.Domain] = r
+	}
+	if _, ok := found["example.com"]; ok {
+		t.Errorf("Expected original domain to be excluded")
+	}
+
+	tests := []struct {
+		domain    string
+		technique Technique
+	}{
+		{"dxample.com", Bitsquatting},
+		{"examp1e.com", Homoglyph},
+		{"exmple.com", Omission},
+		{"exammple.com", Repetition},
+		{"exmaple.com", Transposition},
+		{"exumple.com", VowelSwap},
+		{"exa-mple.com", Hyphenation},
+		{"example.net", TLDSwap},
+		{"example.co.uk", TLDSwap},
+		{"exa.mple.com", SubdomainInsertion},
+	}
+	for _, test := range tests {
+		r, ok := found[test.domain]
+		if !ok {
+			t.Errorf("Expected variant %s", test.domain)
+			continue
+		}
+		if r.Technique != test.technique {
+			t.Errorf("Variant %s has technique %s; want %s", test.domain, r.Technique, test.technique)
+		}
+	}
+
+	// "exаmple.com" with a Cyrillic а.
+	idn, ok := found["xn--exmple-4nf.com"]
+	if !ok || idn.Technique != Homoglyph || idn.Unicode != "exаmple.com" {
+		t.Errorf("Expected IDN homoglyph variant, got %+v", idn)
+	}
+}
+
+func TestGenerateTyposquatsOptions(t *testing.T) {
+	results, err := GenerateTyposquats("example.co.uk", TyposquatOptions{Techniques: []Technique{Omission, TLDSwap}, TLDs: []string{"com", ".CO.UK"}})
+	if err != nil {
+		t.Fatalf("GenerateTyposquats failed: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Technique != Omission && r.Technique != TLDSwap {
+			t.Errorf("Unexpected technique %s for %s", r.Technique, r.Domain)
+		}
+	}
+	if len(results) != 8 {
+		t.Errorf("GenerateTyposquats returned %d variants; want 8: %v", len(results), results)
+	}
+
+	if _, err := GenerateTyposquats("co.uk", TyposquatOptions{}); err == nil {
+		t.Errorf("Expected error for public suffix")
+	}
+	if _, err := GenerateTyposquats("example.com", TyposquatOptions{Techniques: []Technique{"unknown"}}); err == nil {
+		t.Errorf("Expected error for unknown technique")
+	}
+}
@@ -0,0 +1,202 @@
+package domainutil
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/root4loot/goutils/strutil"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Wildcard is the answer set returned for random names under a zone with a wildcard record.
+type Wildcard struct {
+	Zone   string   `json:"zone"`
+	IPs    []string `json:"ips,omitempty"`
+	CNAMEs []string `json:"cnames,omitempty"`
+}
+
+// WildcardDetector learns the wildcard answers of zones and decides whether a resolution
+// result is a genuine record or a wildcard hit. It is safe for concurrent use, and probes
+// each zone only once.
+type WildcardDetector struct {
+	resolver *Resolver
+	probes   int
+
+	mu    sync.Mutex
+	zones map[string]*wildcardProbe
+}
+
+type wildcardProbe struct {
+	done     chan struct{}
+	wildcard *Wildcard
+	err      error
+}
+
+// NewWildcardDetector creates a WildcardDetector that resolves the given number of random names in each zone (default 3).
+func NewWildcardDetector(r *Resolver, probes int) *WildcardDetector {
+	if probes <= 0 {
+		probes = 3
+	}
+	return &WildcardDetector{
+		resolver: r,
+		probes:   probes,
+		zones:    make(map[string]*wildcardProbe),
+	}
+}
+
+// Detect probes zone with random labels and returns the learned wildcard answers,
+// or nil if the zone has no wildcard. Results are cached per zone.
+func (d *WildcardDetector) Detect(ctx context.Context, zone string) (*Wildcard, error) {
+	zone = normalizeName(zone)
+
+	d.mu.Lock()
+	p, ok := d.zones[zone]
+	if !ok {
+		p = &wildcardProbe{done: make(chan struct{})}
+		d.zones[zone] = p
+	}
+	d.mu.Unlock()
+
+	if ok {
+		select {
+		case <-p.done:
+			return p.wildcard, p.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.wildcard, p.err = d.probe(ctx, zone)
+	if p.err != nil {
+		// Don't cache failures; the next caller probes again.
+		d.mu.Lock()
+		delete(d.zones, zone)
+		d.mu.Unlock()
+	}
+	close(p.done)
+	return p.wildcard, p.err
+}
+
+// IsWildcard reports whether answers, the resolution result for host, only contain
+// addresses or CNAME targets learned from a wildcard in one of host's parent zones.
+// Every zone between the registrable domain and the immediate parent of host is probed.
+func (d *WildcardDetector) IsWildcard(ctx context.Context, host string, answers []Record) (bool, error) {
+	ips, cnames := answerSet(host, answers)
+	if len(ips) == 0 && len(cnames) == 0 {
+		return false, nil
+	}
+
+	for _, zone := range parentZones(host) {
+		wildcard, err := d.Detect(ctx, zone)
+		if err != nil {
+			return false, err
+		}
+		if wildcard != nil && wildcard.matches(ips, cnames) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *WildcardDetector) probe(ctx context.Context, zone string) (*Wildcard, error) {
+	ips := make(map[string]bool)
+	cnames := make(map[string]bool)
+
+	for i := 0; i < d.probes; i++ {
+		name := strutil.RandomLabel(16) + "." + zone
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			resp, err := d.resolver.Lookup(ctx, name, qtype)
+			if err != nil {
+				return nil, err
+			}
+			probeIPs, probeCNAMEs := answerSet(name, resp.Answers)
+			for ip := range probeIPs {
+				ips[ip] = true
+			}
+			for cname := range probeCNAMEs {
+				cnames[cname] = true
+			}
+		}
+	}
+
+	if len(ips) == 0 && len(cnames) == 0 {
+		return nil, nil
+	}
+	return &Wildcard{Zone: zone, IPs: sortedKeys(ips), CNAMEs: sortedKeys(cnames)}, nil
+}
+
+// matches reports whether a result is explained by the wildcard. If host has a CNAME,
+// its first target decides; otherwise all addresses must be wildcard addresses.
+func (w *Wildcard) matches(ips, cnames map[string]bool) bool {
+	if len(cnames) > 0 && len(w.CNAMEs) > 0 {
+		for _, cname := range w.CNAMEs {
+			if cnames[cname] {
+				return true
+			}
+		}
+		return false
+	}
+	if len(ips) == 0 {
+		return false
+	}
+	known := make(map[string]bool, len(w.IPs))
+	for _, ip := range w.IPs {
+		known[ip] = true
+	}
+	for ip := range ips {
+		if !known[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+// answerSet returns the addresses and the first CNAME target found in answers for host.
+func answerSet(host string, answers []Record) (ips map[string]bool, cnames map[string]bool) {
+	ips = make(map[string]bool)
+	cnames = make(map[string]bool)
+
+	chain := CNAMEChain(host, answers)
+	owners := map[string]bool{queryName(host): true}
+	for _, rec := range chain {
+		owners[rec.Target] = true
+	}
+	if len(chain) > 0 {
+		cnames[chain[0].Target] = true
+	}
+
+	for _, rec := range answers {
+		if rec.IP != nil && owners[rec.Name] {
+			ips[rec.IP.String()] = true
+		}
+	}
+	return ips, cnames
+}
+
+// parentZones returns the zones between the registrable domain of host and its immediate parent,
+// from the top down.
+func parentZones(host string) []string {
+	host = normalizeName(host)
+	labels := strings.Split(host, ".")
+	top := len(labels) - 2
+	if root, err := RegistrableDomain(host); err == nil {
+		top = len(labels) - len(strings.Split(root, "."))
+	}
+
+	var zones []string
+	for i := top; i >= 1; i-- {
+		zones = append(zones, strings.Join(labels[i:], "."))
+	}
+	return zones
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package domainutil
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestWildcardDetector(t *testing.T) {
+	var queries int32
+	addr := newStubServer(t, func(q dnsmessage.Question, tcp bool) dnsmessage.Message {
+		atomic.AddInt32(&queries, 1)
+		name := q.Name.String()
+		var msg dnsmessage.Message
+		a := func(owner string, ip [4]byte) {
+			if q.Type == dnsmessage.TypeA {
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader(owner, dnsmessage.TypeA, 60), Body: &dnsmessage.AResource{A: ip}})
+			}
+		}
+
+		switch {
+		case name == "real.wild.example.com.":
+			a(name, [4]byte{192, 0, 2, 20})
+		case strings.HasSuffix(name, ".wild.example.com."):
+			a(name, [4]byte{192, 0, 2, 10})
+		case name == "app.cname.example.com.":
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader(name, dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("app.example.net.")}})
+			a("app.example.net.", [4]byte{198, 51, 100, 1})
+		case strings.HasSuffix(name, ".cname.example.com."):
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: rrHeader(name, dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("lb.example.net.")}})
+			a("lb.example.net.", [4]byte{198, 51, 100, 1})
+		case name == "www.example.com.":
+			a(name, [4]byte{192, 0, 2, 10})
+		default:
+			msg.RCode = dnsmessage.RCodeNameError
+		}
+		return msg
+	})
+
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	d := NewWildcardDetector(r, 2)
+	ctx := context.Background()
+
+	wildcard, err := d.Detect(ctx, "wild.example.com")
+	if err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+	if wildcard == nil || len(wildcard.IPs) != 1 || wildcard.IPs[0] != "192.0.2.10" {
+		t.Fatalf("Detect(wild.example.com) = %+v; want wildcard 192.0.2.10", wildcard)
+	}
+	if wildcard, err := d.Detect(ctx, "example.com"); err != nil || wildcard != nil {
+		t.Errorf("Detect(example.com) = %+v, %v; want no wildcard", wildcard, err)
+	}
+
+	tests := []struct {
+		host     string
+		wildcard bool
+	}{
+		{"anything.wild.example.com", true},
+		{"deep.anything.wild.example.com", true},
+		{"real.wild.example.com", false},
+		{"www.example.com", false},
+		{"foo.cname.example.com", true},
+		{"app.cname.example.com", false},
+	}
+
+	for _, test := range tests {
+		resp, err := r.Lookup(ctx, test.host, dnsmessage.TypeA)
+		if err != nil {
+			t.Fatalf("Lookup(%s) failed: %v", test.host, err)
+		}
+		isWildcard, err := d.IsWildcard(ctx, test.host, resp.Answers)
+		if err != nil {
+			t.Fatalf("IsWildcard(%s) failed: %v", test.host, err)
+		}
+		if isWildcard != test.wildcard {
+			t.Errorf("IsWildcard(%s) = %v; want %v", test.host, isWildcard, test.wildcard)
+		}
+	}
+
+	// Zones are only probed once.
+	before := atomic.LoadInt32(&queries)
+	if _, err := d.IsWildcard(ctx, "other.wild.example.com", []Record{{Name: "other.wild.example.com", Type: "A", Data: "192.0.2.10", IP: []byte{192, 0, 2, 10}}}); err != nil {
+		t.Fatalf("IsWildcard failed: %v", err)
+	}
+	if after := atomic.LoadInt32(&queries); after != before {
+		t.Errorf("Expected cached wildcard probes, got %d new queries", after-before)
+	}
+}
+
+func TestParentZones(t *testing.T) {
+	got := parentZones("a.b.shop.example.co.uk")
+	want := []string{"example.co.uk", "shop.example.co.uk", "b.shop.example.co.uk"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("parentZones = %v; want %v", got, want)
+	}
+}
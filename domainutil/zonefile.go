@@ -0,0 +1,729 @@
+package domainutil
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ParseZone parses an RFC 1035 master file and returns its records in file order.
+// origin is the initial $ORIGIN and may be empty if the file sets one before using relative names.
+// $ORIGIN and $TTL directives, "@", relative names, omitted owners, TTLs and classes,
+// parenthesized multiline records, comments, BIND-style TTL units such as "1h30m" and the
+// RFC 3597 generic "\#" format are supported. $INCLUDE and $GENERATE are not.
+// Records of types that are not decoded, such as DS or RRSIG, keep their data as written.
+func ParseZone(r io.Reader, origin string) ([]Record, error) {
+	p := &zoneParser{}
+	if origin != "" {
+		p.origin = strings.ToLower(fqdn(origin))
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var records []Record
+	var tokens []zoneToken
+	var depth, start int
+	blankOwner := false
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if depth == 0 {
+			start = line
+			blankOwner = text != "" && (text[0] == ' ' || text[0] == '\t')
+		}
+
+		var err error
+		tokens, err = tokenizeZoneLine(text, &depth, tokens)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if depth > 0 || len(tokens) == 0 {
+			continue
+		}
+
+		rec, ok, err := p.parseEntry(tokens, blankOwner)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", start, err)
+		}
+		if ok {
+			records = append(records, rec)
+		}
+		tokens = tokens[:0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unclosed parenthesis", start)
+	}
+
+	return records, nil
+}
+
+// LoadZoneFile parses the master file at filePath. See ParseZone.
+func LoadZoneFile(filePath, origin string) ([]Record, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseZone(f, origin)
+}
+
+// NewRecord builds a Record from its presentation format, as found in zone files and tool output,
+// e.g. NewRecord("example.com", "MX", 300, "10 mail.example.com."). Names are treated as absolute.
+// The result is identical to the Record returned by a lookup of the same data, except for types
+// that are not decoded, which keep data as given.
+func NewRecord(name, rtype string, ttl uint32, data string) (Record, error) {
+	t, err := ParseType(rtype)
+	if err != nil {
+		return Record{}, err
+	}
+	depth := 0
+	tokens, err := tokenizeZoneLine(data, &depth, nil)
+	if err != nil {
+		return Record{}, err
+	}
+	if depth != 0 {
+		return Record{}, errors.New("unbalanced parenthesis")
+	}
+
+	p := &zoneParser{origin: "."}
+	owner, err := p.name(name)
+	if err != nil {
+		return Record{}, err
+	}
+	return p.record(owner, t, ttl, tokens)
+}
+
+// String returns the record as a zone file line.
+func (rec Record) String() string {
+	return fmt.Sprintf("%s.\t%d\tIN\t%s\t%s", rec.Name, rec.TTL, rec.Type, rec.Data)
+}
+
+// zoneToken is a whitespace-delimited field of a master file with escapes and quotes removed.
+type zoneToken struct {
+	text   string
+	raw    string
+	quoted bool
+}
+
+// tokenizeZoneLine appends the tokens of a single line to tokens. depth tracks open parentheses across lines.
+func tokenizeZoneLine(line string, depth *int, tokens []zoneToken) ([]zoneToken, error) {
+	var text, raw strings.Builder
+	inToken, inQuote, quoted := false, false, false
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, zoneToken{text: text.String(), raw: raw.String(), quoted: quoted})
+		}
+		text.Reset()
+		raw.Reset()
+		inToken, quoted = false, false
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(line) {
+				return nil, errors.New("trailing backslash")
+			}
+			inToken = true
+			if i+3 < len(line) && isDigits(line[i+1:i+4]) {
+				n, _ := strconv.Atoi(line[i+1 : i+4])
+				if n > 255 {
+					return nil, fmt.Errorf("invalid escape \\%s", line[i+1:i+4])
+				}
+				text.WriteByte(byte(n))
+				raw.WriteString(line[i : i+4])
+				i += 3
+			} else {
+				text.WriteByte(line[i+1])
+				raw.WriteString(line[i : i+2])
+				i++
+			}
+		case c == '"':
+			inToken, quoted = true, true
+			inQuote = !inQuote
+		case inQuote:
+			text.WriteByte(c)
+			raw.WriteByte(c)
+		case c == ';':
+			flush()
+			return tokens, nil
+		case c == '(':
+			flush()
+			*depth++
+		case c == ')':
+			flush()
+			if *depth == 0 {
+				return nil, errors.New("unbalanced parenthesis")
+			}
+			*depth--
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		default:
+			inToken = true
+			text.WriteByte(c)
+			raw.WriteByte(c)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quoted string")
+	}
+	flush()
+	return tokens, nil
+}
+
+// zoneParser holds the state carried between the entries of a master file.
+type zoneParser struct {
+	origin     string // absolute, or empty if not yet known
+	defaultTTL uint32 // $TTL
+	hasDefault bool
+	lastTTL    uint32 // TTL of the previous record, used if no $TTL is set
+	hasLast    bool
+	lastOwner  string
+}
+
+// parseEntry handles a directive or a record. ok is false for directives.
+func (p *zoneParser) parseEntry(tokens []zoneToken, blankOwner bool) (rec Record, ok bool, err error) {
+	if first := tokens[0].text; !blankOwner && strings.HasPrefix(first, "$") {
+		switch strings.ToUpper(first) {
+		case "$ORIGIN":
+			if len(tokens) < 2 {
+				return Record{}, false, errors.New("$ORIGIN requires a name")
+			}
+			origin, err := p.name(tokens[1].text)
+			if err != nil {
+				return Record{}, false, err
+			}
+			p.origin = origin
+		case "$TTL":
+			if len(tokens) < 2 {
+				return Record{}, false, errors.New("$TTL requires a value")
+			}
+			ttl, err := parseTTL(tokens[1].text)
+			if err != nil {
+				return Record{}, false, err
+			}
+			p.defaultTTL, p.hasDefault = ttl, true
+		default:
+			return Record{}, false, fmt.Errorf("unsupported directive %s", first)
+		}
+		return Record{}, false, nil
+	}
+
+	owner := p.lastOwner
+	if !blankOwner {
+		if owner, err = p.name(tokens[0].text); err != nil {
+			return Record{}, false, err
+		}
+		tokens = tokens[1:]
+	}
+	if owner == "" {
+		return Record{}, false, errors.New("record without owner name")
+	}
+	p.lastOwner = owner
+
+	// The TTL and class are optional and may appear in either order.
+	var ttl uint32
+	hasTTL := false
+	for i := 0; i < 2 && len(tokens) > 0; i++ {
+		field := tokens[0].text
+		if !hasTTL && field != "" && field[0] >= '0' && field[0] <= '9' {
+			if ttl, err = parseTTL(field); err != nil {
+				return Record{}, false, err
+			}
+			hasTTL = true
+		} else if isZoneClass(field) {
+			if !strings.EqualFold(field, "IN") {
+				return Record{}, false, fmt.Errorf("unsupported class %s", field)
+			}
+		} else {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return Record{}, false, errors.New("missing record type")
+	}
+	// An omitted TTL is the $TTL default, or the TTL of the previous record if there is none (RFC 2308).
+	switch {
+	case hasTTL:
+		p.lastTTL, p.hasLast = ttl, true
+	case p.hasDefault:
+		ttl = p.defaultTTL
+	case p.hasLast:
+		ttl = p.lastTTL
+	default:
+		return Record{}, false, errors.New("no TTL specified and no $TTL set")
+	}
+
+	t, err := ParseType(tokens[0].text)
+	if err != nil {
+		return Record{}, false, err
+	}
+	rec, err = p.record(owner, t, ttl, tokens[1:])
+	return rec, err == nil, err
+}
+
+// name returns the absolute form of a name found in a master file.
+func (p *zoneParser) name(s string) (string, error) {
+	switch {
+	case s == "@":
+		if p.origin == "" {
+			return "", errors.New("@ used without $ORIGIN")
+		}
+		return p.origin, nil
+	case strings.HasSuffix(s, "."):
+		return strings.ToLower(fqdn(s)), nil
+	case p.origin == "":
+		return "", fmt.Errorf("relative name %q used without $ORIGIN", s)
+	case p.origin == ".":
+		return strings.ToLower(fqdn(s)), nil
+	}
+	return strings.ToLower(fqdn(s)) + p.origin, nil
+}
+
+// record builds a Record from presentation format rdata.
+func (p *zoneParser) record(owner string, t dnsmessage.Type, ttl uint32, rdata []zoneToken) (Record, error) {
+	ownerName, err := dnsmessage.NewName(owner)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid name %q: %v", owner, err)
+	}
+	header := dnsmessage.ResourceHeader{Name: ownerName, Type: t, Class: dnsmessage.ClassINET, TTL: ttl}
+
+	var body dnsmessage.ResourceBody
+	if len(rdata) > 0 && rdata[0].raw == `\#` && !rdata[0].quoted {
+		body, err = p.genericBody(t, rdata[1:])
+	} else {
+		body, err = p.body(t, rdata)
+		if err == errUndecodedType && len(rdata) > 0 {
+			return Record{Name: normalizeName(owner), Type: TypeString(t), TTL: ttl, Data: rawRData(rdata)}, nil
+		}
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid %s record %s: %v", TypeString(t), normalizeName(owner), err)
+	}
+	return recordFromResource(dnsmessage.Resource{Header: header, Body: body}), nil
+}
+
+// body parses the rdata of the types that have a presentation format.
+func (p *zoneParser) body(t dnsmessage.Type, rdata []zoneToken) (dnsmessage.ResourceBody, error) {
+	args := make([]string, len(rdata))
+	for i, tok := range rdata {
+		args[i] = tok.text
+	}
+	want := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("expected %d fields, got %d", n, len(args))
+		}
+		return nil
+	}
+
+	switch t {
+	case dnsmessage.TypeA:
+		if err := want(1); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(args[0]).To4()
+		if ip == nil || strings.Contains(args[0], ":") {
+			return nil, fmt.Errorf("invalid IPv4 address %q", args[0])
+		}
+		var a dnsmessage.AResource
+		copy(a.A[:], ip)
+		return &a, nil
+
+	case dnsmessage.TypeAAAA:
+		if err := want(1); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(args[0])
+		if ip == nil || !strings.Contains(args[0], ":") {
+			return nil, fmt.Errorf("invalid IPv6 address %q", args[0])
+		}
+		var aaaa dnsmessage.AAAAResource
+		copy(aaaa.AAAA[:], ip.To16())
+		return &aaaa, nil
+
+	case dnsmessage.TypeNS, dnsmessage.TypeCNAME, dnsmessage.TypePTR:
+		if err := want(1); err != nil {
+			return nil, err
+		}
+		name, err := p.wireName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case dnsmessage.TypeNS:
+			return &dnsmessage.NSResource{NS: name}, nil
+		case dnsmessage.TypeCNAME:
+			return &dnsmessage.CNAMEResource{CNAME: name}, nil
+		}
+		return &dnsmessage.PTRResource{PTR: name}, nil
+
+	case dnsmessage.TypeMX:
+		if err := want(2); err != nil {
+			return nil, err
+		}
+		pref, err := parseUint16(args[0])
+		if err != nil {
+			return nil, err
+		}
+		mx, err := p.wireName(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.MXResource{Pref: pref, MX: mx}, nil
+
+	case dnsmessage.TypeTXT:
+		if len(args) == 0 {
+			return nil, errors.New("missing text")
+		}
+		for _, s := range args {
+			if len(s) > 255 {
+				return nil, errors.New("character-string longer than 255 bytes")
+			}
+		}
+		return &dnsmessage.TXTResource{TXT: args}, nil
+
+	case dnsmessage.TypeSRV:
+		if err := want(4); err != nil {
+			return nil, err
+		}
+		var nums [3]uint16
+		for i := range nums {
+			n, err := parseUint16(args[i])
+			if err != nil {
+				return nil, err
+			}
+			nums[i] = n
+		}
+		target, err := p.wireName(args[3])
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.SRVResource{Priority: nums[0], Weight: nums[1], Port: nums[2], Target: target}, nil
+
+	case dnsmessage.TypeSOA:
+		if err := want(7); err != nil {
+			return nil, err
+		}
+		ns, err := p.wireName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		mbox, err := p.wireName(args[1])
+		if err != nil {
+			return nil, err
+		}
+		serial, err := strconv.ParseUint(args[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid serial %q", args[2])
+		}
+		var timers [4]uint32
+		for i := range timers {
+			if timers[i], err = parseTTL(args[3+i]); err != nil {
+				return nil, err
+			}
+		}
+		return &dnsmessage.SOAResource{NS: ns, MBox: mbox, Serial: uint32(serial),
+			Refresh: timers[0], Retry: timers[1], Expire: timers[2], MinTTL: timers[3]}, nil
+
+	case TypeCAA:
+		if err := want(3); err != nil {
+			return nil, err
+		}
+		flags, err := strconv.ParseUint(args[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags %q", args[0])
+		}
+		if args[1] == "" || len(args[1]) > 255 {
+			return nil, fmt.Errorf("invalid tag %q", args[1])
+		}
+		data := append([]byte{byte(flags), byte(len(args[1]))}, args[1]...)
+		return &dnsmessage.UnknownResource{Type: t, Data: append(data, args[2]...)}, nil
+
+	case TypeSVCB, TypeHTTPS:
+		data, err := p.svcbData(args)
+		if err != nil {
+			return nil, err
+		}
+		return &dnsmessage.UnknownResource{Type: t, Data: data}, nil
+	}
+
+	return nil, errUndecodedType
+}
+
+// errUndecodedType is returned by zoneParser.body for types without a presentation format parser.
+var errUndecodedType = errors.New("missing record data")
+
+// rawRData returns rdata as written, with quoted strings quoted again.
+func rawRData(rdata []zoneToken) string {
+	fields := make([]string, len(rdata))
+	for i, tok := range rdata {
+		if tok.quoted {
+			fields[i] = quoteString(tok.text)
+		} else {
+			fields[i] = tok.raw
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// genericBody parses RFC 3597 "\# length hex" rdata. Data of known types is decoded
+// so that the record is the same as one written in the type's own format.
+func (p *zoneParser) genericBody(t dnsmessage.Type, rdata []zoneToken) (dnsmessage.ResourceBody, error) {
+	if len(rdata) == 0 {
+		return nil, errors.New("missing length")
+	}
+	length, err := strconv.Atoi(rdata[0].text)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid length %q", rdata[0].text)
+	}
+	var hexData strings.Builder
+	for _, tok := range rdata[1:] {
+		hexData.WriteString(tok.text)
+	}
+	data, err := hex.DecodeString(hexData.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %v", err)
+	}
+	if len(data) != length {
+		return nil, fmt.Errorf("length %d does not match %d bytes of data", length, len(data))
+	}
+
+	// Let dnsmessage decode the data by packing it into a message and unpacking it again.
+	msg := dnsmessage.Message{Answers: []dnsmessage.Resource{{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("."), Type: t, Class: dnsmessage.ClassINET},
+		Body:   &dnsmessage.UnknownResource{Type: t, Data: data},
+	}}}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.Unpack(packed); err != nil {
+		return nil, err
+	}
+	return msg.Answers[0].Body, nil
+}
+
+// svcbData packs the priority, target and service parameters of a SVCB or HTTPS record (RFC 9460).
+func (p *zoneParser) svcbData(args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, errors.New("expected priority and target")
+	}
+	priority, err := parseUint16(args[0])
+	if err != nil {
+		return nil, err
+	}
+	target := args[1]
+	if target != "." {
+		if target, err = p.name(target); err != nil {
+			return nil, err
+		}
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, priority)
+	for _, label := range strings.Split(strings.TrimSuffix(target, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			return nil, fmt.Errorf("label too long in %q", target)
+		}
+		data = append(append(data, byte(len(label))), label...)
+	}
+	data = append(data, 0)
+
+	type param struct {
+		key   uint16
+		value []byte
+	}
+	var params []param
+	for _, arg := range args[2:] {
+		name, value, _ := strings.Cut(arg, "=")
+		key, err := svcParamKey(name)
+		if err != nil {
+			return nil, err
+		}
+		packed, err := packSvcParam(key, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		params = append(params, param{key, packed})
+	}
+	// Parameters must appear in increasing key order.
+	sort.Slice(params, func(i, j int) bool { return params[i].key < params[j].key })
+
+	for _, prm := range params {
+		data = binary.BigEndian.AppendUint16(data, prm.key)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(prm.value)))
+		data = append(data, prm.value...)
+	}
+	return data, nil
+}
+
+// svcParamKey returns the key number of a service parameter name, e.g. "alpn" or "key65001".
+func svcParamKey(name string) (uint16, error) {
+	name = strings.ToLower(name)
+	for i, key := range svcParamKeys {
+		if key == name {
+			return uint16(i), nil
+		}
+	}
+	if strings.HasPrefix(name, "key") {
+		if n, err := strconv.ParseUint(name[3:], 10, 16); err == nil {
+			return uint16(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown service parameter %q", name)
+}
+
+// packSvcParam returns the wire format of a service parameter value.
+func packSvcParam(key uint16, value string) ([]byte, error) {
+	var data []byte
+	switch key {
+	case 0: // mandatory
+		for _, name := range strings.Split(value, ",") {
+			k, err := svcParamKey(name)
+			if err != nil {
+				return nil, err
+			}
+			data = binary.BigEndian.AppendUint16(data, k)
+		}
+	case 1: // alpn
+		for _, id := range strings.Split(value, ",") {
+			if id == "" || len(id) > 255 {
+				return nil, fmt.Errorf("invalid protocol %q", id)
+			}
+			data = append(append(data, byte(len(id))), id...)
+		}
+	case 2: // no-default-alpn
+		if value != "" {
+			return nil, errors.New("no value expected")
+		}
+	case 3: // port
+		port, err := parseUint16(value)
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint16(data, port)
+	case 4, 6: // ipv4hint, ipv6hint
+		for _, s := range strings.Split(value, ",") {
+			ip := net.ParseIP(s)
+			if ip == nil || (key == 4) != (ip.To4() != nil && !strings.Contains(s, ":")) {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			if key == 4 {
+				ip = ip.To4()
+			}
+			data = append(data, ip...)
+		}
+	case 5: // ech
+		return base64.StdEncoding.DecodeString(value)
+	default:
+		data = []byte(value)
+	}
+	return data, nil
+}
+
+// wireName parses a name in rdata, resolving it against the origin.
+func (p *zoneParser) wireName(s string) (dnsmessage.Name, error) {
+	name, err := p.name(s)
+	if err != nil {
+		return dnsmessage.Name{}, err
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Name{}, fmt.Errorf("invalid name %q: %v", s, err)
+	}
+	return n, nil
+}
+
+// parseTTL parses a TTL in seconds or with BIND-style units, e.g. "3600", "1h" or "1d12h".
+func parseTTL(s string) (uint32, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	var total, current uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			current = current*10 + uint64(c-'0')
+			digits = true
+			if current > 1<<32 {
+				return 0, fmt.Errorf("invalid TTL %q", s)
+			}
+			continue
+		}
+		if !digits {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		switch c | 0x20 {
+		case 's':
+			total += current
+		case 'm':
+			total += current * 60
+		case 'h':
+			total += current * 3600
+		case 'd':
+			total += current * 86400
+		case 'w':
+			total += current * 604800
+		default:
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		current, digits = 0, false
+	}
+	if digits {
+		// A trailing number without unit is seconds.
+		total += current
+	}
+	if s == "" || total > 1<<32-1 {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return uint32(total), nil
+}
+
+func parseUint16(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint16(n), nil
+}
+
+func isZoneClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CH", "CS", "HS":
+		return true
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,220 @@
+package domainutil
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const testZone = `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2024010101 ; serial
+		2h         ; refresh
+		15m        ; retry
+		2w         ; expire
+		300 )      ; minimum
+	IN	NS	ns1
+	IN	NS	ns2.example.net.
+	IN	MX	10 mail
+	IN	TXT	"v=spf1 include:_spf.example.net -all" "second \"part\""
+	IN	CAA	0 issue "letsencrypt.org"
+www	300	IN	A	192.0.2.1
+	IN	300	AAAA	2001:db8::1
+mail		A	192.0.2.25
+ftp		CNAME	www
+_sip._tcp	SRV	10 60 5060 sip
+svc		HTTPS	1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1
+raw		TYPE1	\# 4 C0000202
+$ORIGIN sub.example.com.
+host		A	198.51.100.7 ; comment
+`
+
+func TestParseZone(t *testing.T) {
+	records, err := ParseZone(strings.NewReader(testZone), "")
+	if err != nil {
+		t.Fatalf("ParseZone failed: %v", err)
+	}
+
+	want := []struct {
+		name, rtype, data string
+		ttl               uint32
+	}{
+		{"example.com", "SOA", "ns1.example.com. hostmaster.example.com. 2024010101 7200 900 1209600 300", 3600},
+		{"example.com", "NS", "ns1.example.com.", 3600},
+		{"example.com", "NS", "ns2.example.net.", 3600},
+		{"example.com", "MX", "10 mail.example.com.", 3600},
+		{"example.com", "TXT", `"v=spf1 include:_spf.example.net -all" "second \"part\""`, 3600},
+		{"example.com", "CAA", `0 issue "letsencrypt.org"`, 3600},
+		{"www.example.com", "A", "192.0.2.1", 300},
+		{"www.example.com", "AAAA", "2001:db8::1", 300},
+		{"mail.example.com", "A", "192.0.2.25", 3600},
+		{"ftp.example.com", "CNAME", "www.example.com.", 3600},
+		{"_sip._tcp.example.com", "SRV", "10 60 5060 sip.example.com.", 3600},
+		{"svc.example.com", "HTTPS", "1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1", 3600},
+		{"raw.example.com", "A", "192.0.2.2", 3600},
+		{"host.sub.example.com", "A", "198.51.100.7", 3600},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("ParseZone returned %d records; want %d: %v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec.Name != w.name || rec.Type != w.rtype || rec.Data != w.data || rec.TTL != w.ttl {
+			t.Errorf("record %d = %s; want %s %d %s %s", i, rec, w.name, w.ttl, w.rtype, w.data)
+		}
+	}
+
+	if soa := records[0].SOA; soa == nil || soa.Serial != 2024010101 || soa.MinTTL != 300 {
+		t.Errorf("Unexpected SOA data %+v", records[0].SOA)
+	}
+	if records[3].Target != "mail.example.com" || records[3].Priority != 10 {
+		t.Errorf("Unexpected MX fields %+v", records[3])
+	}
+	if records[11].Params["port"] != "8443" {
+		t.Errorf("Unexpected HTTPS params %v", records[11].Params)
+	}
+}
+
+func TestParseZoneTTL(t *testing.T) {
+	tests := []struct {
+		zone string
+		want []uint32
+	}{
+		// $TTL applies to every record without a TTL, regardless of earlier explicit TTLs.
+		{"$TTL 3600\n@ 60 IN A 192.0.2.1\nwww IN A 192.0.2.2\nmail 120 A 192.0.2.3\nftp A 192.0.2.4", []uint32{60, 3600, 120, 3600}},
+		// Without $TTL, the TTL of the previous record is used.
+		{"@ 60 IN A 192.0.2.1\nwww IN A 192.0.2.2\nmail 120 A 192.0.2.3\nftp A 192.0.2.4", []uint32{60, 60, 120, 120}},
+		// A later $TTL takes over from the previous record.
+		{"@ 60 IN A 192.0.2.1\n$TTL 300\nwww IN A 192.0.2.2", []uint32{60, 300}},
+	}
+
+	for _, test := range tests {
+		records, err := ParseZone(strings.NewReader(test.zone), "example.com")
+		if err != nil {
+			t.Fatalf("ParseZone(%q) failed: %v", test.zone, err)
+		}
+		if len(records) != len(test.want) {
+			t.Fatalf("ParseZone(%q) returned %d records; want %d", test.zone, len(records), len(test.want))
+		}
+		for i, want := range test.want {
+			if records[i].TTL != want {
+				t.Errorf("ParseZone(%q): record %d TTL = %d; want %d", test.zone, i, records[i].TTL, want)
+			}
+		}
+	}
+}
+
+func TestParseZoneUndecodedTypes(t *testing.T) {
+	zone := `$ORIGIN example.com.
+$TTL 3600
+@	DS	12345 13 2 ( 3A3C5E8B5F0B1F0D1C8E6A2B
+		9D7F4E3C2B1A0F9E8D7C6B5A4F3E2D1C0B1A2F3E )
+	DNSKEY	257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==
+	RRSIG	DNSKEY 13 2 3600 20240201000000 20240101000000 12345 example.com. ( AbCd+/== )
+	NSEC	www.example.com. A NS SOA RRSIG NSEC DNSKEY
+_443._tcp.www	TLSA	3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6
+www	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp.example.com.
+www	A	192.0.2.1
+`
+	records, err := ParseZone(strings.NewReader(zone), "")
+	if err != nil {
+		t.Fatalf("ParseZone failed: %v", err)
+	}
+
+	want := []struct {
+		name, rtype, data string
+	}{
+		{"example.com", "DS", "12345 13 2 3A3C5E8B5F0B1F0D1C8E6A2B 9D7F4E3C2B1A0F9E8D7C6B5A4F3E2D1C0B1A2F3E"},
+		{"example.com", "DNSKEY", "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="},
+		{"example.com", "RRSIG", "DNSKEY 13 2 3600 20240201000000 20240101000000 12345 example.com. AbCd+/=="},
+		{"example.com", "NSEC", "www.example.com. A NS SOA RRSIG NSEC DNSKEY"},
+		{"_443._tcp.www.example.com", "TLSA", "3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"},
+		{"www.example.com", "NAPTR", `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{"www.example.com", "A", "192.0.2.1"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("ParseZone returned %d records; want %d: %v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec.Name != w.name || rec.Type != w.rtype || rec.Data != w.data || rec.TTL != 3600 {
+			t.Errorf("record %d = %s; want %s 3600 %s %s", i, rec, w.name, w.rtype, w.data)
+		}
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	tests := []struct {
+		zone   string
+		origin string
+	}{
+		{"www A 192.0.2.1", "example.com"},                    // no TTL
+		{"$TTL 300\nwww A 192.0.2.1", ""},                     // relative name without origin
+		{"$TTL 300\nwww.example.com. A 300.0.0.1", ""},        // invalid address
+		{"$TTL 300\nwww.example.com. A ( 192.0.2.1", ""},      // unclosed parenthesis
+		{"$TTL 300\nwww.example.com. TXT \"unterminated", ""}, // unterminated string
+		{"$INCLUDE other.zone", "example.com"},
+		{"$TTL 300\nwww.example.com. CH A 192.0.2.1", ""},
+		{"$TTL 300\nwww.example.com. TYPE1 \\# 3 C00002", ""}, // wrong length
+		{"$TTL 300\nwww.example.com. BOGUS 1 2 3", ""},
+		{"$TTL 300\nwww.example.com. DS", ""}, // no data
+	}
+
+	for _, test := range tests {
+		if _, err := ParseZone(strings.NewReader(test.zone), test.origin); err == nil {
+			t.Errorf("ParseZone(%q) succeeded; want error", test.zone)
+		}
+	}
+}
+
+func TestNewRecordMatchesLookup(t *testing.T) {
+	addr := newStubServer(t, recordsHandler)
+	r, err := NewResolver(ResolverOptions{Servers: []string{addr}})
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeMX, dnsmessage.TypeTXT, dnsmessage.TypeSOA, TypeCAA, TypeHTTPS} {
+		resp, err := r.Lookup(context.Background(), "example.com", qtype)
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		for _, want := range resp.Answers {
+			got, err := NewRecord(want.Name, want.Type, want.TTL, want.Data)
+			if err != nil {
+				t.Errorf("NewRecord(%s) failed: %v", want, err)
+				continue
+			}
+			if got.String() != want.String() || got.Target != want.Target || len(got.Text) != len(want.Text) {
+				t.Errorf("NewRecord(%s) = %+v; want %+v", want, got, want)
+			}
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint32
+		ok    bool
+	}{
+		{"3600", 3600, true},
+		{"1h", 3600, true},
+		{"1H30m", 5400, true},
+		{"1w1d", 691200, true},
+		{"90s", 90, true},
+		{"", 0, false},
+		{"h", 0, false},
+		{"1y", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseTTL(test.input)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseTTL(%q) = %d, %v; want %d", test.input, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/root4loot/goutils/netutil"
+)
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User-Agent", r.Header.Get("User-Agent"))
+		w.Header().Set("X-Token", r.Header.Get("X-Token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithUserAgent("scanner/1.0"), WithHeader("X-Token", "secret"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	// TLS verification is disabled by default, so the self-signed certificate is accepted.
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-User-Agent"); got != "scanner/1.0" {
+		t.Errorf("Expected User-Agent 'scanner/1.0', got '%s'", got)
+	}
+	if got := resp.Header.Get("X-Token"); got != "secret" {
+		t.Errorf("Expected X-Token 'secret', got '%s'", got)
+	}
+
+	// Headers set on the request take precedence.
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("User-Agent", "custom")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-User-Agent"); got != "custom" {
+		t.Errorf("Expected User-Agent 'custom', got '%s'", got)
+	}
+
+	client, err = NewClient(WithTLSVerify(true))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected certificate error with TLS verification enabled")
+	}
+}
+
+func TestNewClientRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/final" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next := "/final"
+		if r.URL.Path == "/" {
+			next = "/step"
+		}
+		http.Redirect(w, r, server.URL+next, http.StatusFound)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		maxRedirects int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{10, http.StatusOK, false},
+		{2, http.StatusOK, false},
+		{1, 0, true},
+		{0, http.StatusFound, false},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(WithMaxRedirects(test.maxRedirects))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		resp, err := client.Get(server.URL + "/")
+		if test.wantErr {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("WithMaxRedirects(%d): expected error", test.maxRedirects)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("WithMaxRedirects(%d): %v", test.maxRedirects, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("WithMaxRedirects(%d): status = %d; want %d", test.maxRedirects, resp.StatusCode, test.wantStatus)
+		}
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithTimeout(50 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected timeout error")
+	}
+}
+
+func TestNewClientKeepAlives(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		keepAlives bool
+		wantConns  int32
+	}{
+		{true, 1},
+		{false, 3},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&conns, 0)
+		client, err := NewClient(WithKeepAlives(test.keepAlives))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			resp.Body.Close()
+		}
+		if n := atomic.LoadInt32(&conns); n != test.wantConns {
+			t.Errorf("WithKeepAlives(%v): %d connections; want %d", test.keepAlives, n, test.wantConns)
+		}
+	}
+}
+
+func TestNewClientOptionErrors(t *testing.T) {
+	tests := []ClientOption{
+		WithProxy("ftp://127.0.0.1:21"),
+		WithProxy("://bad"),
+		WithProxy("http://"),
+	}
+	for i, opt := range tests {
+		if _, err := NewClient(opt); err == nil {
+			t.Errorf("option %d: expected error", i)
+		}
+	}
+
+	client, err := NewClient(WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}), WithProxy(""))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if client.Timeout != 10*time.Second {
+		t.Errorf("Expected default timeout of 10s, got %v", client.Timeout)
+	}
+	if transport := client.Transport.(*headerTransport).base.(*http.Transport); transport.Proxy != nil || transport.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Unexpected transport configuration: %+v", transport)
+	}
+}
+
+// newForwardProxy starts an HTTP forward proxy that relays plain HTTP requests and records
+// the Proxy-Authorization header of the last one.
+func newForwardProxy(t *testing.T) (*httptest.Server, *atomic.Value) {
+	t.Helper()
+	var auth atomic.Value
+	auth.Store("")
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Proxy-Authorization"))
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Via", "test-proxy")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &auth
+}
+
+func TestNewClientProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	proxy, auth := newForwardProxy(t)
+
+	client, err := NewClient(WithProxy("http://user:pass@" + strings.TrimPrefix(proxy.URL, "http://")))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("Via") != "test-proxy" {
+		t.Errorf("Expected request to go through the proxy")
+	}
+	// "user:pass" in base64.
+	if got := auth.Load().(string); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected Proxy-Authorization 'Basic dXNlcjpwYXNz', got '%s'", got)
+	}
+}
+
+func TestNewClientProxyPool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	proxy, _ := newForwardProxy(t)
+
+	// Reserve a port and close it so that the proxy is unreachable.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	dead := "http://" + ln.Addr().String()
+	ln.Close()
+
+	pool, err := netutil.NewProxyPool([]string{dead, proxy.URL}, netutil.ProxyPoolOptions{MaxFailures: 1})
+	if err != nil {
+		t.Fatalf("NewProxyPool failed: %v", err)
+	}
+	client, err := NewClient(WithProxyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.Header.Get("Via") != "test-proxy" {
+			t.Errorf("Expected request to go through the live proxy")
+		}
+	}
+
+	if alive := pool.AliveProxies(); len(alive) != 1 || alive[0] != proxy.URL {
+		t.Errorf("AliveProxies() = %v; want [%s]", alive, proxy.URL)
+	}
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy without authentication that sends each requested target
+// address on targets. Targets that refuse connections get a "connection refused" reply.
+func newSOCKS5Proxy(t *testing.T, targets chan<- string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up proxy: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				io.ReadFull(conn, buf[:buf[1]])
+				conn.Write([]byte{5, 0})
+
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 1:
+					io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					io.ReadFull(conn, buf[:1])
+					name := make([]byte, buf[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				io.ReadFull(conn, buf[:2])
+				address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+				targets <- address
+
+				target, err := net.Dial("tcp", address)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestNewClientSOCKSProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	targets := make(chan string, 8)
+	proxyAddr := newSOCKS5Proxy(t, targets)
+
+	tests := []struct {
+		scheme     string
+		wantTarget string
+	}{
+		{"socks5h", "localhost:" + port},
+		{"socks5", "127.0.0.1:" + port},
+	}
+	for _, test := range tests {
+		client, err := NewClient(WithProxy(test.scheme+"://"+proxyAddr), WithKeepAlives(false))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		resp, err := client.Get("http://localhost:" + port)
+		if err != nil {
+			t.Fatalf("%s: Failed to make GET request: %v", test.scheme, err)
+		}
+		resp.Body.Close()
+		if got := <-targets; got != test.wantTarget {
+			t.Errorf("%s: proxy was asked for %s; want %s", test.scheme, got, test.wantTarget)
+		}
+	}
+}
+
+func TestNewClientProxyPoolSOCKSConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Connections dialed through one proxy must not be reused for requests sent through the other.
+	targetsA, targetsB := make(chan string, 8), make(chan string, 8)
+	pool, err := netutil.NewProxyPool([]string{"socks5h://" + newSOCKS5Proxy(t, targetsA), "socks5h://" + newSOCKS5Proxy(t, targetsB)}, netutil.ProxyPoolOptions{})
+	if err != nil {
+		t.Fatalf("NewProxyPool failed: %v", err)
+	}
+	client, err := NewClient(WithProxyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if len(targetsA) != 1 || len(targetsB) != 1 {
+		t.Errorf("Expected one connection through each proxy, got %d and %d", len(targetsA), len(targetsB))
+	}
+}
+
+func TestNewClientProxyPoolTargetErrors(t *testing.T) {
+	// Reserve a port and close it so that the target refuses connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	refused := "http://" + ln.Addr().String()
+	ln.Close()
+
+	proxyURL := "socks5h://" + newSOCKS5Proxy(t, make(chan string, 8))
+	pool, err := netutil.NewProxyPool([]string{proxyURL}, netutil.ProxyPoolOptions{MaxFailures: 1})
+	if err != nil {
+		t.Fatalf("NewProxyPool failed: %v", err)
+	}
+	client, err := NewClient(WithProxyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(refused); err == nil {
+			t.Fatalf("Expected error for a refused target")
+		}
+	}
+	if alive := pool.AliveProxies(); len(alive) != 1 {
+		t.Errorf("AliveProxies() = %v; want the proxy to stay alive after refused targets", alive)
+	}
+}
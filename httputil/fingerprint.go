@@ -0,0 +1,291 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ResponseFingerprint summarizes an HTTP response for probing.
+type ResponseFingerprint struct {
+	URL           string       `json:"url"`
+	StatusCode    int          `json:"status_code"`
+	Title         string       `json:"title,omitempty"`
+	Server        string       `json:"server,omitempty"`
+	ContentType   string       `json:"content_type,omitempty"`
+	ContentLength int64        `json:"content_length"` // bytes in the body, or the Content-Length header if the body was truncated
+	Words         int          `json:"words"`
+	Lines         int          `json:"lines"`
+	FaviconURL    string       `json:"favicon_url,omitempty"`
+	FaviconHash   int32        `json:"favicon_hash,omitempty"` // Shodan-compatible mmh3 hash, see FaviconHash
+	Technologies  []Technology `json:"technologies,omitempty"`
+}
+
+// FingerprintOptions configures FingerprintWithOptions.
+type FingerprintOptions struct {
+	Client      *http.Client     // client used to fetch the favicon (default: a shared client from NewClient())
+	SkipFavicon bool             // do not fetch the favicon
+	MaxBodySize int64            // bytes of the response body inspected (default 1MB)
+	Rules       *TechnologyRules // technology rules (default: DefaultTechnologyRules())
+}
+
+// DefaultFingerprintOptions returns the options used when fields of FingerprintOptions are left unset.
+func DefaultFingerprintOptions() FingerprintOptions {
+	return FingerprintOptions{
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// Fingerprint is FingerprintWithOptions with the default options.
+func Fingerprint(resp *http.Response) (*ResponseFingerprint, error) {
+	return FingerprintWithOptions(resp, FingerprintOptions{})
+}
+
+// FingerprintWithOptions extracts the title, server banner, size, word and line counts and
+// technologies of resp, and fetches and hashes the site's favicon using the context of
+// resp.Request. The body is read up to MaxBodySize and then restored, so the caller can
+// still read it in full. A favicon that cannot be fetched leaves FaviconHash unset.
+func FingerprintWithOptions(resp *http.Response, opts FingerprintOptions) (*ResponseFingerprint, error) {
+	opts = opts.withDefaults()
+
+	body, err := peekBody(resp, opts.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &ResponseFingerprint{
+		StatusCode:    resp.StatusCode,
+		Server:        resp.Header.Get("Server"),
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: int64(len(body)),
+		Words:         len(strings.Fields(string(body))),
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		fp.URL = resp.Request.URL.String()
+	}
+	if int64(len(body)) == opts.MaxBodySize && resp.ContentLength > fp.ContentLength {
+		fp.ContentLength = resp.ContentLength
+	}
+	if len(body) > 0 {
+		fp.Lines = bytes.Count(body, []byte("\n")) + 1
+	}
+
+	var doc *html.Node
+	if isHTML(fp.ContentType) {
+		if doc, err = html.Parse(bytes.NewReader(body)); err != nil {
+			doc = nil
+		}
+	}
+	page := parsePage(doc)
+	fp.Title = page.title
+
+	rules := opts.Rules
+	if rules == nil {
+		rules = DefaultTechnologyRules()
+	}
+	fp.Technologies = rules.match(resp, string(body), page)
+
+	if !opts.SkipFavicon && resp.Request != nil && resp.Request.URL != nil {
+		fp.FaviconURL, fp.FaviconHash = fetchFavicon(resp.Request, page.icon, opts.Client)
+	}
+	return fp, nil
+}
+
+// peekBody reads up to n bytes of the body of resp and puts them back in front of the rest,
+// so that the body can still be read in full.
+func peekBody(resp *http.Response, n int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return body, nil
+}
+
+// FaviconHash returns the hash Shodan uses to index favicons (http.favicon.hash): the
+// 32-bit MurmurHash3 of the base64 encoding of data, with a newline after every 76
+// characters and at the end, as a signed integer.
+func FaviconHash(data []byte) int32 {
+	return int32(murmur3([]byte(base64Lines(data)), 0))
+}
+
+// pageInfo holds what is extracted from an HTML document.
+type pageInfo struct {
+	title   string
+	icon    string            // href of the first <link rel="icon">
+	scripts []string          // src of <script> elements
+	meta    map[string]string // content of <meta> elements by lowercase name or property
+}
+
+func parsePage(doc *html.Node) pageInfo {
+	p := pageInfo{meta: make(map[string]string)}
+	if doc == nil {
+		return p
+	}
+
+	var titleSeen bool
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if !titleSeen && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+					titleSeen = true
+					p.title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+			case "link":
+				if p.icon == "" && hasToken(attr(n, "rel"), "icon") {
+					p.icon = strings.TrimSpace(attr(n, "href"))
+				}
+			case "script":
+				if src := strings.TrimSpace(attr(n, "src")); src != "" {
+					p.scripts = append(p.scripts, src)
+				}
+			case "meta":
+				name := attr(n, "name")
+				if name == "" {
+					name = attr(n, "property")
+				}
+				if name = strings.ToLower(name); name != "" {
+					if _, ok := p.meta[name]; !ok {
+						p.meta[name] = attr(n, "content")
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return p
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the space-separated list s contains token, ignoring case.
+func hasToken(s, token string) bool {
+	for _, field := range strings.Fields(s) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchFavicon requests the icon linked from the page, or /favicon.ico, relative to the
+// URL of req. It returns the URL and hash of the icon, or empty values if it could not be fetched.
+func fetchFavicon(req *http.Request, href string, client *http.Client) (string, int32) {
+	if href == "" {
+		href = "/favicon.ico"
+	}
+	iconURL, err := req.URL.Parse(href)
+	if err != nil || (iconURL.Scheme != "http" && iconURL.Scheme != "https") {
+		// Inline data: icons are not fetched.
+		return "", 0
+	}
+
+	if client == nil {
+		if client, err = sharedClient(); err != nil {
+			return "", 0
+		}
+	}
+	iconReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, iconURL.String(), nil)
+	if err != nil {
+		return "", 0
+	}
+	resp, err := client.Do(iconReq)
+	if err != nil {
+		return "", 0
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || resp.StatusCode != http.StatusOK || len(data) == 0 {
+		return "", 0
+	}
+	return iconURL.String(), FaviconHash(data)
+}
+
+// base64Lines encodes data like Python's base64.encodebytes, which Shodan hashes.
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if encoded == "" {
+		return ""
+	}
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// murmur3 is the x86 32-bit variant of MurmurHash3.
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func (o FingerprintOptions) withDefaults() FingerprintOptions {
+	def := DefaultFingerprintOptions()
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = def.MaxBodySize
+	}
+	return o
+}
@@ -0,0 +1,201 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const fingerprintPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>
+    Example   Blog
+  </title>
+  <meta name="generator" content="WordPress 6.4.2">
+  <link rel="shortcut icon" href="/static/icon.png">
+  <script src="/wp-includes/js/jquery/jquery-3.6.0.min.js"></script>
+</head>
+<body>hello world</body>
+</html>`
+
+var fingerprintIcon = []byte("\x89PNG\r\n\x1a\nnot really an icon")
+
+func newFingerprintServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Server", "nginx/1.18.0")
+			w.Header().Set("X-Powered-By", "PHP/8.1.2")
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "abc"})
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, fingerprintPage)
+		case "/static/icon.png":
+			w.Write(fingerprintIcon)
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "<title>not html</title>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFingerprint(t *testing.T) {
+	server := newFingerprintServer(t)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	fp, err := Fingerprint(resp)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+
+	if fp.URL != server.URL || fp.StatusCode != http.StatusOK {
+		t.Errorf("Expected %s with status 200, got %s with status %d", server.URL, fp.URL, fp.StatusCode)
+	}
+	if fp.Title != "Example Blog" {
+		t.Errorf("Expected title %q, got %q", "Example Blog", fp.Title)
+	}
+	if fp.Server != "nginx/1.18.0" {
+		t.Errorf("Expected server %q, got %q", "nginx/1.18.0", fp.Server)
+	}
+	if fp.ContentLength != int64(len(fingerprintPage)) || fp.Lines != 12 || fp.Words != len(strings.Fields(fingerprintPage)) {
+		t.Errorf("Expected %d bytes, 12 lines and %d words, got %d, %d and %d",
+			len(fingerprintPage), len(strings.Fields(fingerprintPage)), fp.ContentLength, fp.Lines, fp.Words)
+	}
+	if fp.FaviconURL != server.URL+"/static/icon.png" || fp.FaviconHash != FaviconHash(fingerprintIcon) {
+		t.Errorf("Expected favicon %s with hash %d, got %s with hash %d",
+			server.URL+"/static/icon.png", FaviconHash(fingerprintIcon), fp.FaviconURL, fp.FaviconHash)
+	}
+
+	want := map[string]string{
+		"jQuery":    "3.6.0",
+		"MySQL":     "",
+		"Nginx":     "1.18.0",
+		"PHP":       "8.1.2",
+		"WordPress": "6.4.2",
+	}
+	got := make(map[string]string)
+	for _, tech := range fp.Technologies {
+		got[tech.Name] = tech.Version
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected technologies %v, got %+v", want, fp.Technologies)
+	}
+	for name, version := range want {
+		if v, ok := got[name]; !ok || v != version {
+			t.Errorf("Expected %s %q to be detected, got %+v", name, version, fp.Technologies)
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != fingerprintPage {
+		t.Errorf("Expected the body to remain readable, got %q, %v", body, err)
+	}
+}
+
+func TestFingerprintOptions(t *testing.T) {
+	server := newFingerprintServer(t)
+
+	resp, err := http.Get(server.URL + "/plain")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	fp, err := FingerprintWithOptions(resp, FingerprintOptions{MaxBodySize: 7})
+	if err != nil {
+		t.Fatalf("FingerprintWithOptions failed: %v", err)
+	}
+	if fp.Title != "" {
+		t.Errorf("Expected no title for a text/plain response, got %q", fp.Title)
+	}
+	if fp.ContentLength != 23 {
+		t.Errorf("Expected the Content-Length header for a truncated body, got %d", fp.ContentLength)
+	}
+	if fp.FaviconURL != "" || fp.FaviconHash != 0 {
+		t.Errorf("Expected no favicon when /favicon.ico is missing, got %s %d", fp.FaviconURL, fp.FaviconHash)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "<title>not html</title>" {
+		t.Errorf("Expected the full body to remain readable, got %q", body)
+	}
+
+	rules, err := ParseTechnologyRules(strings.NewReader(`{"Custom": {"html": "<title>(not) html\\;version:\\1"}}`))
+	if err != nil {
+		t.Fatalf("ParseTechnologyRules failed: %v", err)
+	}
+	resp, err = http.Get(server.URL + "/plain")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+	fp, err = FingerprintWithOptions(resp, FingerprintOptions{Rules: rules, SkipFavicon: true})
+	if err != nil {
+		t.Fatalf("FingerprintWithOptions failed: %v", err)
+	}
+	if len(fp.Technologies) != 1 || fp.Technologies[0].Name != "Custom" || fp.Technologies[0].Version != "not" {
+		t.Errorf("Expected custom technology to be detected, got %+v", fp.Technologies)
+	}
+}
+
+func TestParseTechnologyRules(t *testing.T) {
+	if n := DefaultTechnologyRules().Len(); n == 0 {
+		t.Errorf("Expected embedded technology rules")
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"Bad": {"html": "("}}`,
+		`{"Bad": {"headers": {"Server": ["ok", "[z-a]"]}}}`,
+	}
+	for _, rules := range invalid {
+		if _, err := ParseTechnologyRules(strings.NewReader(rules)); err == nil {
+			t.Errorf("ParseTechnologyRules(%s) succeeded; want error", rules)
+		}
+	}
+}
+
+func TestFaviconHash(t *testing.T) {
+	tests := []struct {
+		data []byte
+		seed uint32
+		want uint32
+	}{
+		{[]byte(""), 0, 0},
+		{[]byte(""), 1, 0x514e28b7},
+		{[]byte("\x00\x00\x00\x00"), 0, 0x2362f9de},
+		{[]byte("foo"), 0, 0xf6a5c420},
+		{[]byte("Hello, world!"), 0x9747b28c, 0x24884cba},
+		{[]byte("aaaa"), 0x9747b28c, 0x5a97808a},
+	}
+	for _, test := range tests {
+		if got := murmur3(test.data, test.seed); got != test.want {
+			t.Errorf("murmur3(%q, %#x) = %#x; want %#x", test.data, test.seed, got, test.want)
+		}
+	}
+
+	data := make([]byte, 120)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	want := "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4vMDEyMzQ1Njc4\n" +
+		"OTo7PD0+P0BBQkNERUZHSElKS0xNTk9QUVJTVFVWV1hZWltcXV5fYGFiY2RlZmdoaWprbG1ub3Bx\n" +
+		"cnN0dXZ3\n"
+	if got := base64Lines(data); got != want {
+		t.Errorf("base64Lines() = %q; want %q", got, want)
+	}
+	if got := FaviconHash(data); got != int32(murmur3([]byte(want), 0)) {
+		t.Errorf("FaviconHash() = %d; want %d", got, int32(murmur3([]byte(want), 0)))
+	}
+}
@@ -2,120 +2,102 @@ package httputil
 
 import (
 	"context"
-	"crypto/tls"
-	"fmt"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/root4loot/goutils/urlutil"
+	"github.com/root4loot/goutils/domainutil"
 	"golang.org/x/net/html"
 )
 
-var ipCache sync.Map
-
 // ClientWithOptionalResolvers creates an HTTP client with optional custom DNS resolvers.
 // If no resolvers are provided, the default system resolver is used.
-// If a resolver is provided without a port, ":53" is appended to it.
-// The client uses the default Go resolver if the custom resolvers fail to resolve the domain.
+// Resolvers are DNS servers as accepted by domainutil.NewResolver, e.g. "8.8.8.8" or "1.1.1.1:53".
+// The client uses the system resolver only if the custom resolvers cannot be reached or time out.
+// Names they answer as nonexistent are not looked up elsewhere.
+// Resolved addresses are cached for the TTL of their records. The client is created with
+// NewClient, with keep-alives disabled.
 func ClientWithOptionalResolvers(resolvers ...string) (*http.Client, error) {
+	var resolver domainutil.LookupResolver = domainutil.SystemResolver(nil, time.Minute)
 	if len(resolvers) > 0 {
-		for i, resolver := range resolvers {
-			_, _, err := net.SplitHostPort(resolver)
-			if err != nil {
-				resolvers[i] = resolver + ":53"
-			}
+		custom, err := domainutil.NewResolver(domainutil.ResolverOptions{Servers: resolvers})
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		resolvers = []string{}
-	}
-
-	defaultResolver := &net.Resolver{PreferGo: true}
-
-	dialer := &net.Dialer{
-		Resolver: defaultResolver,
+		resolver = &fallbackResolver{primary: custom, fallback: resolver}
 	}
 
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
-			if cachedIP, ok := ipCache.Load(address); ok {
-				if conn, ok := cachedIP.(net.Conn); ok {
-					return conn, nil
-				}
-			}
-
-			conn, err := dialer.DialContext(ctx, network, address)
-			if err != nil {
-				for _, resolver := range resolvers {
-					d := net.Dialer{}
-					conn, err = d.DialContext(ctx, network, resolver)
-					if err != nil {
-						continue
-					}
-
-					ipCache.Store(address, conn)
+	return ClientWithDNSCache(domainutil.NewCache(resolver, domainutil.CacheOptions{}), WithKeepAlives(false))
+}
 
-					return conn, nil
-				}
-				return nil, fmt.Errorf("failed to resolve domain using custom resolvers")
-			}
+// fallbackResolver resolves names through primary, and through fallback if primary could not
+// answer. Answers that a name does not exist are returned as they are.
+type fallbackResolver struct {
+	primary  domainutil.LookupResolver
+	fallback domainutil.LookupResolver
+}
 
-			ipCache.Store(address, conn)
+func (r *fallbackResolver) LookupIP(ctx context.Context, host string) ([]domainutil.IPRecord, error) {
+	ips, err := r.primary.LookupIP(ctx, host)
+	if shouldFallBack(ctx, err) {
+		return r.fallback.LookupIP(ctx, host)
+	}
+	return ips, err
+}
 
-			return conn, nil
-		},
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-		DisableKeepAlives:   true,
-		MaxIdleConnsPerHost: -1,
+func (r *fallbackResolver) LookupPTR(ctx context.Context, ip string) ([]domainutil.Record, error) {
+	names, err := r.primary.LookupPTR(ctx, ip)
+	if shouldFallBack(ctx, err) {
+		return r.fallback.LookupPTR(ctx, ip)
 	}
+	return names, err
+}
 
-	client := &http.Client{
-		Transport: transport,
+// shouldFallBack reports whether err means the primary resolver could not answer, as opposed
+// to answering that the name does not exist.
+func shouldFallBack(ctx context.Context, err error) bool {
+	var dnsErr *net.DNSError
+	if err == nil || ctx.Err() != nil {
+		return false
 	}
+	return !errors.As(err, &dnsErr) || !dnsErr.IsNotFound
+}
 
-	return client, nil
+// ClientWithDNSCache creates an HTTP client with NewClient and opts that resolves hostnames
+// through the given DNS cache, so that clients sharing a cache never resolve the same name
+// twice while its records are valid. TLS and other settings are taken from opts.
+func ClientWithDNSCache(cache *domainutil.Cache, opts ...ClientOption) (*http.Client, error) {
+	return NewClient(append(opts[:len(opts):len(opts)], WithDNSCache(cache))...)
 }
 
-// FindScheme attempts to find the scheme of a given target URL.
+// FindScheme attempts to find the scheme of a given target URL by probing it over HTTP.
+// Targets with a scheme are returned as is if they respond. Otherwise HTTPS and HTTP are
+// probed concurrently, HTTPS only for port 443 and HTTP only for port 80, and HTTPS is
+// preferred if both respond. It returns the scheme and the URL that responded.
 func FindScheme(target string) (string, string, error) {
-	timeout := 5 * time.Second
-	var err error
-
-	if strings.Contains(target, "://") {
-		if err = urlutil.CanReachURLWithTimeout(target, timeout); err == nil {
-			return strings.Split(target, "://")[0], target, nil
+	opts := ProbeOptions{Timeout: 5 * time.Second}
+	if !strings.Contains(target, "://") {
+		if _, port, err := net.SplitHostPort(target); err == nil {
+			switch port {
+			case "443":
+				opts.Schemes = []string{"https"}
+			case "80":
+				opts.Schemes = []string{"http"}
+			}
 		}
-		return "", "", err
 	}
 
-	host, port, _ := net.SplitHostPort(target)
-	if host == "" {
-		host = target
+	var result ProbeResult
+	for r := range ProbeSlice(context.Background(), []string{target}, opts) {
+		result = r
 	}
-
-	var urlsToTest []string
-	switch port {
-	case "443":
-		urlsToTest = []string{"https://" + host}
-	case "80":
-		urlsToTest = []string{"http://" + host}
-	default:
-		urlsToTest = []string{"https://" + host, "http://" + host}
+	if result.Err != nil {
+		return "", "", result.Err
 	}
-
-	for _, url := range urlsToTest {
-		if err := urlutil.CanReachURLWithTimeout(url, timeout); err == nil {
-			if port != "" {
-				url = url + ":" + port
-			}
-			return strings.Split(url, "://")[0], url, nil
-		}
-	}
-
-	return "", "", net.ErrClosed
+	return result.Scheme, result.URL, nil
 }
 
 // RedirectsToHTTPS checks if a given HTTP URL redirects to an HTTPS URL.
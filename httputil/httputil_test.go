@@ -1,9 +1,17 @@
 package httputil
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+
+	"github.com/root4loot/goutils/domainutil"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestClientWithOptionalResolvers(t *testing.T) {
@@ -28,6 +36,159 @@ func TestClientWithOptionalResolvers(t *testing.T) {
 	}
 }
 
+// newDNSServer starts a UDP DNS server that resolves app.test to 127.0.0.1 and counts its queries.
+func newDNSServer(t *testing.T) (string, *int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var queries int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			atomic.AddInt32(&queries, 1)
+
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+				Questions: query.Questions,
+			}
+			switch {
+			case q.Name.String() != "app.test.":
+				resp.RCode = dnsmessage.RCodeNameError
+			case q.Type == dnsmessage.TypeA:
+				resp.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+			packed, err := resp.Pack()
+			if err == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestClientWithOptionalResolversCustom(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	dnsAddr, queries := newDNSServer(t)
+	client, err := ClientWithOptionalResolvers(dnsAddr)
+	if err != nil {
+		t.Fatalf("ClientWithOptionalResolvers failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get("http://app.test:" + port + "/")
+			if err != nil {
+				errs <- err
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Failed to make GET request: %v", err)
+	}
+
+	// One A and one AAAA query, shared by all requests.
+	if n := atomic.LoadInt32(queries); n != 2 {
+		t.Errorf("Expected 2 DNS queries, got %d", n)
+	}
+
+	// Names the custom resolver answers as nonexistent are not looked up elsewhere.
+	if resp, err := client.Get("http://localhost:" + port + "/"); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected error for a name the custom resolver does not know")
+	}
+
+	// The system resolver is used if the custom resolver cannot be reached.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	unreachable := conn.LocalAddr().String()
+	conn.Close()
+	client, err = ClientWithOptionalResolvers(unreachable)
+	if err != nil {
+		t.Fatalf("ClientWithOptionalResolvers failed: %v", err)
+	}
+	resp, err := client.Get("http://localhost:" + port + "/")
+	if err != nil {
+		t.Fatalf("Failed to make GET request via fallback: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := ClientWithOptionalResolvers("ftp://8.8.8.8"); err == nil {
+		t.Errorf("Expected error for invalid resolver")
+	}
+}
+
+// staticResolver resolves every name to 127.0.0.1 and counts its lookups.
+type staticResolver struct {
+	lookups int
+}
+
+func (r *staticResolver) LookupIP(ctx context.Context, host string) ([]domainutil.IPRecord, error) {
+	r.lookups++
+	return []domainutil.IPRecord{{IP: net.ParseIP("127.0.0.1"), TTL: 300}}, nil
+}
+
+func (r *staticResolver) LookupPTR(ctx context.Context, ip string) ([]domainutil.Record, error) {
+	return nil, nil
+}
+
+func TestClientWithDNSCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	resolver := &staticResolver{}
+	// Disable keep-alives so that every request dials again.
+	client, err := ClientWithDNSCache(domainutil.NewCache(resolver, domainutil.CacheOptions{}), WithKeepAlives(false))
+	if err != nil {
+		t.Fatalf("ClientWithDNSCache failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://app.test:" + port + "/")
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if resolver.lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d", resolver.lookups)
+	}
+}
+
 func TestFindScheme(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -48,6 +209,27 @@ func TestFindScheme(t *testing.T) {
 	}
 }
 
+func TestFindSchemeHostPort(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	target := strings.TrimPrefix(server.URL, "https://")
+	scheme, url, err := FindScheme(target)
+	if err != nil {
+		t.Fatalf("FindScheme failed: %v", err)
+	}
+
+	if scheme != "https" {
+		t.Errorf("Expected scheme 'https', got '%s'", scheme)
+	}
+
+	if url != server.URL {
+		t.Errorf("Expected URL '%s', got '%s'", server.URL, url)
+	}
+}
+
 func TestRedirectsToHTTPS(t *testing.T) {
 	httpsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
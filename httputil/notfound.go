@@ -0,0 +1,319 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/root4loot/goutils/strutil"
+)
+
+// NotFoundOptions configures a NotFoundDetector.
+type NotFoundOptions struct {
+	Samples         int          // random paths requested per host (default 3)
+	MaxBodySize     int64        // bytes of each body compared (default 1MB)
+	LengthTolerance float64      // relative difference in body length and word count still considered equal (default 0.05)
+	MaxDistance     int          // maximum number of differing bits of similar similarity hashes (default 4)
+	Client          *http.Client // client used for baseline requests (default: a shared client from NewClient())
+}
+
+// DefaultNotFoundOptions returns the options used when fields of NotFoundOptions are left unset.
+func DefaultNotFoundOptions() NotFoundOptions {
+	return NotFoundOptions{
+		Samples:         3,
+		MaxBodySize:     1 << 20,
+		LengthTolerance: 0.05,
+		MaxDistance:     4,
+	}
+}
+
+// NotFoundBaseline is how a host responds to paths that do not exist.
+type NotFoundBaseline struct {
+	BaseURL  string            `json:"base_url"` // scheme://host the baseline was built for
+	Clusters []NotFoundCluster `json:"clusters"`
+	opts     NotFoundOptions
+}
+
+// NotFoundCluster is a group of similar responses to random paths.
+type NotFoundCluster struct {
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location,omitempty"` // Location header with the requested path removed
+	MinLength  int    `json:"min_length"`
+	MaxLength  int    `json:"max_length"`
+	MinWords   int    `json:"min_words"`
+	MaxWords   int    `json:"max_words"`
+	Hash       uint64 `json:"hash"` // SimHash of the first body
+	Count      int    `json:"count"`
+}
+
+// NotFoundDetector learns how hosts respond to paths that do not exist, so that brute-force
+// results which merely repeat that response (soft 404s, catch-all pages and redirects) can be
+// discarded. It is safe for concurrent use, and builds the baseline of each host only once.
+type NotFoundDetector struct {
+	opts NotFoundOptions
+
+	mu    sync.Mutex
+	hosts map[string]*notFoundProbe
+}
+
+type notFoundProbe struct {
+	done     chan struct{}
+	baseline *NotFoundBaseline
+	err      error
+}
+
+// NewNotFoundDetector creates a NotFoundDetector.
+func NewNotFoundDetector(opts NotFoundOptions) *NotFoundDetector {
+	return &NotFoundDetector{
+		opts:  opts.withDefaults(),
+		hosts: make(map[string]*notFoundProbe),
+	}
+}
+
+// Baseline returns the baseline of the scheme and host of target, building it on first use.
+// Failed baselines are not cached.
+func (d *NotFoundDetector) Baseline(ctx context.Context, target string) (*NotFoundBaseline, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL: %q", target)
+	}
+	key := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	d.mu.Lock()
+	p, ok := d.hosts[key]
+	if !ok {
+		p = &notFoundProbe{done: make(chan struct{})}
+		d.hosts[key] = p
+	}
+	d.mu.Unlock()
+
+	if ok {
+		select {
+		case <-p.done:
+			return p.baseline, p.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.baseline, p.err = BuildNotFoundBaseline(ctx, key, d.opts)
+	if p.err != nil {
+		d.mu.Lock()
+		delete(d.hosts, key)
+		d.mu.Unlock()
+	}
+	close(p.done)
+	return p.baseline, p.err
+}
+
+// IsLikelyNotFound reports whether resp is a 404 or 410 response, or matches the baseline of
+// its host, which is built using the context of resp.Request if needed. See
+// NotFoundBaseline.IsLikelyNotFound.
+func (d *NotFoundDetector) IsLikelyNotFound(resp *http.Response) (bool, error) {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return true, nil
+	}
+	if resp.Request == nil || resp.Request.URL == nil {
+		return false, fmt.Errorf("response has no request URL")
+	}
+	baseline, err := d.Baseline(resp.Request.Context(), resp.Request.URL.String())
+	if err != nil {
+		return false, err
+	}
+	return baseline.IsLikelyNotFound(resp), nil
+}
+
+// BuildNotFoundBaseline requests random paths under baseURL and clusters the responses by
+// status, redirect location, length, word count and similarity of the body.
+func BuildNotFoundBaseline(ctx context.Context, baseURL string, opts NotFoundOptions) (*NotFoundBaseline, error) {
+	opts = opts.withDefaults()
+	base, err := url.Parse(baseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL: %q", baseURL)
+	}
+	client := opts.Client
+	if client == nil {
+		if client, err = sharedClient(); err != nil {
+			return nil, err
+		}
+	}
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	b := &NotFoundBaseline{BaseURL: base.Scheme + "://" + base.Host, opts: opts}
+	// Vary the shape of the path, as servers often route files, extensions and directories differently.
+	shapes := []string{"/%s", "/%s.html", "/%s/"}
+	for i := 0; i < opts.Samples; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseURL+fmt.Sprintf(shapes[i%len(shapes)], strutil.RandomLabel(16)), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := noFollow.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		sample, err := newNotFoundSample(resp, opts.MaxBodySize)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		b.add(sample)
+	}
+	return b, nil
+}
+
+// Wildcard reports whether the host answers random paths with something other than 404 or 410,
+// i.e. whether a plain status check is not enough to tell missing paths apart.
+func (b *NotFoundBaseline) Wildcard() bool {
+	for _, c := range b.Clusters {
+		if c.StatusCode != http.StatusNotFound && c.StatusCode != http.StatusGone {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLikelyNotFound reports whether resp is a 404 or 410 response, or has the status of a
+// baseline cluster along with its redirect location and a similar body. Bodies are similar if
+// their length and word count are within the range seen for the cluster, widened by
+// LengthTolerance, and their similarity hashes differ in at most MaxDistance bits. The path
+// of the request is removed from bodies and locations before comparing them, so pages that
+// echo it still match. As the baseline does not follow redirects, neither should the request
+// of resp. The body of resp is restored after reading it.
+func (b *NotFoundBaseline) IsLikelyNotFound(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return true
+	}
+	sample, err := newNotFoundSample(resp, b.opts.MaxBodySize)
+	if err != nil {
+		return false
+	}
+	for i := range b.Clusters {
+		if b.Clusters[i].matches(sample, b.opts) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *NotFoundBaseline) add(s notFoundSample) {
+	for i := range b.Clusters {
+		c := &b.Clusters[i]
+		if c.matches(s, b.opts) {
+			c.Count++
+			if s.length < c.MinLength {
+				c.MinLength = s.length
+			}
+			if s.length > c.MaxLength {
+				c.MaxLength = s.length
+			}
+			if s.words < c.MinWords {
+				c.MinWords = s.words
+			}
+			if s.words > c.MaxWords {
+				c.MaxWords = s.words
+			}
+			return
+		}
+	}
+	b.Clusters = append(b.Clusters, NotFoundCluster{
+		StatusCode: s.status,
+		Location:   s.location,
+		MinLength:  s.length,
+		MaxLength:  s.length,
+		MinWords:   s.words,
+		MaxWords:   s.words,
+		Hash:       s.hash,
+		Count:      1,
+	})
+}
+
+func (c *NotFoundCluster) matches(s notFoundSample, opts NotFoundOptions) bool {
+	if c.StatusCode != s.status || c.Location != s.location {
+		return false
+	}
+	// Length and word count only rule out bodies cheaply; similar bodies must also have
+	// similar content, so that real pages the size of the not-found page are kept.
+	if !withinTolerance(s.length, c.MinLength, c.MaxLength, opts.LengthTolerance) ||
+		!withinTolerance(s.words, c.MinWords, c.MaxWords, opts.LengthTolerance) {
+		return false
+	}
+	return SimHashDistance(c.Hash, s.hash) <= opts.MaxDistance
+}
+
+func withinTolerance(n, min, max int, tolerance float64) bool {
+	return float64(n) >= float64(min)*(1-tolerance) && float64(n) <= float64(max)*(1+tolerance)
+}
+
+// notFoundSample is a response with the request path removed from its body and location.
+type notFoundSample struct {
+	status   int
+	location string
+	length   int
+	words    int
+	hash     uint64
+}
+
+func newNotFoundSample(resp *http.Response, maxBodySize int64) (notFoundSample, error) {
+	body, err := peekBody(resp, maxBodySize)
+	if err != nil {
+		return notFoundSample{}, err
+	}
+
+	var reqURL *url.URL
+	if resp.Request != nil {
+		reqURL = resp.Request.URL
+	}
+	text := stripRequestPath(string(body), reqURL)
+	return notFoundSample{
+		status:   resp.StatusCode,
+		location: stripRequestPath(resp.Header.Get("Location"), reqURL),
+		length:   len(text),
+		words:    len(strings.Fields(text)),
+		hash:     SimHash([]byte(text)),
+	}, nil
+}
+
+// stripRequestPath removes the path of u, and its last segment, from s.
+func stripRequestPath(s string, u *url.URL) string {
+	if u == nil || s == "" {
+		return s
+	}
+	paths := []string{u.EscapedPath(), u.Path}
+	segment := strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(segment, "/"); i >= 0 {
+		segment = segment[i+1:]
+	}
+	// Short segments would remove unrelated text.
+	if len(segment) >= 4 {
+		paths = append(paths, segment, url.PathEscape(segment))
+	}
+	for _, p := range paths {
+		if p != "" && p != "/" {
+			s = strings.ReplaceAll(s, p, "")
+		}
+	}
+	return s
+}
+
+func (o NotFoundOptions) withDefaults() NotFoundOptions {
+	def := DefaultNotFoundOptions()
+	if o.Samples <= 0 {
+		o.Samples = def.Samples
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = def.MaxBodySize
+	}
+	if o.LengthTolerance <= 0 {
+		o.LengthTolerance = def.LengthTolerance
+	}
+	if o.MaxDistance <= 0 {
+		o.MaxDistance = def.MaxDistance
+	}
+	return o
+}
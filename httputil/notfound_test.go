@@ -0,0 +1,147 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/root4loot/goutils/strutil"
+)
+
+func newNotFoundServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch {
+		case r.URL.Path == "/admin":
+			fmt.Fprint(w, `<html><head><title>Admin</title></head><body><form action="/login">
+				<input name="user"><input name="password" type="password"><button>Sign in</button>
+				</form><p>Authorized personnel only. All access is logged and monitored.</p></body></html>`)
+		case r.URL.Path == "/news":
+			// A real page of about the size and word count of the catch-all page.
+			fmt.Fprintf(w, "<html><body><h2>News</h2><p>Our new shop opens on Monday.</p><!-- %d --></body></html>",
+				time.Now().UnixNano())
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/app/"):
+			http.Redirect(w, r, "/login?next="+r.URL.Path, http.StatusFound)
+		default:
+			// A catch-all page that echoes the path and changes on every request.
+			fmt.Fprintf(w, "<html><body><h1>Oops</h1><p>The page %s could not be found.</p><!-- %d --></body></html>",
+				r.URL.Path, time.Now().UnixNano())
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func getNoFollow(t *testing.T, url string) *http.Response {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestNotFoundBaseline(t *testing.T) {
+	server, _ := newNotFoundServer(t)
+
+	baseline, err := BuildNotFoundBaseline(context.Background(), server.URL, NotFoundOptions{})
+	if err != nil {
+		t.Fatalf("BuildNotFoundBaseline failed: %v", err)
+	}
+	if !baseline.Wildcard() || len(baseline.Clusters) != 1 || baseline.Clusters[0].Count != 3 {
+		t.Errorf("Expected one wildcard cluster of 3 responses, got %+v", baseline.Clusters)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/admin", false},
+		{"/news", false},
+		{"/backup.zip", true},
+		{"/a-much-longer-path-that-is-echoed-back/into/the/page.php", true},
+		{"/missing", true},
+	}
+	for _, test := range tests {
+		resp := getNoFollow(t, server.URL+test.path)
+		if got := baseline.IsLikelyNotFound(resp); got != test.want {
+			t.Errorf("IsLikelyNotFound(%s) = %v; want %v", test.path, got, test.want)
+		}
+	}
+
+	resp := getNoFollow(t, server.URL+"/admin")
+	baseline.IsLikelyNotFound(resp)
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "Authorized personnel only") {
+		t.Errorf("Expected the body to remain readable, got %q", body)
+	}
+}
+
+func TestNotFoundBaselineRedirect(t *testing.T) {
+	server, _ := newNotFoundServer(t)
+
+	baseline, err := BuildNotFoundBaseline(context.Background(), server.URL+"/app/", NotFoundOptions{})
+	if err != nil {
+		t.Fatalf("BuildNotFoundBaseline failed: %v", err)
+	}
+	// The baseline is built for the host, not the path.
+	if baseline.BaseURL != server.URL || baseline.Clusters[0].StatusCode != http.StatusOK {
+		t.Errorf("Expected a baseline of the host, got %+v", baseline)
+	}
+
+	redirects := &NotFoundBaseline{opts: DefaultNotFoundOptions()}
+	for i := 0; i < 3; i++ {
+		resp := getNoFollow(t, server.URL+"/app/"+strutil.RandomLabel(16))
+		sample, err := newNotFoundSample(resp, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirects.add(sample)
+	}
+	if len(redirects.Clusters) != 1 || redirects.Clusters[0].Location != "/login?next=" {
+		t.Fatalf("Expected one redirect cluster, got %+v", redirects.Clusters)
+	}
+	if !redirects.IsLikelyNotFound(getNoFollow(t, server.URL+"/app/settings")) {
+		t.Errorf("Expected redirect to the same location to be likely not found")
+	}
+	if redirects.IsLikelyNotFound(getNoFollow(t, server.URL+"/admin")) {
+		t.Errorf("Expected 200 response not to match a redirect cluster")
+	}
+}
+
+func TestNotFoundDetector(t *testing.T) {
+	server, requests := newNotFoundServer(t)
+	detector := NewNotFoundDetector(NotFoundOptions{Samples: 2})
+
+	for _, path := range []string{"/admin", "/nothing-here", "/admin"} {
+		resp := getNoFollow(t, server.URL+path)
+		got, err := detector.IsLikelyNotFound(resp)
+		if err != nil {
+			t.Fatalf("IsLikelyNotFound failed: %v", err)
+		}
+		if want := path != "/admin"; got != want {
+			t.Errorf("IsLikelyNotFound(%s) = %v; want %v", path, got, want)
+		}
+	}
+	// 3 requests made by the test and 2 for the baseline, which is built once.
+	if n := atomic.LoadInt32(requests); n != 5 {
+		t.Errorf("Expected 5 requests, got %d", n)
+	}
+
+	if _, err := detector.Baseline(context.Background(), "ftp://example.com"); err == nil {
+		t.Errorf("Expected error for non-HTTP URL")
+	}
+}
@@ -0,0 +1,417 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/root4loot/goutils/netutil"
+	"golang.org/x/net/html"
+)
+
+// ProbeOptions configures Probe.
+type ProbeOptions struct {
+	Schemes         []string      // schemes tried for targets without one, in order of preference (default https, http)
+	Ports           []int         // ports tried for targets without one, 0 for the default port of the scheme (default 0)
+	Concurrency     int           // maximum number of requests in flight (default 50)
+	Timeout         time.Duration // timeout for each request, including redirects (default 10s)
+	FollowRedirects bool          // follow redirects and report the last response
+	MaxRedirects    int           // redirects followed when FollowRedirects is set (default 10)
+	AllSchemes      bool          // report every scheme that responds rather than only the preferred one
+	Fingerprint     bool          // include a full fingerprint of each response, see Fingerprint
+	MaxBodySize     int64         // bytes of each body read for the title and fingerprint (default 1MB)
+	Client          *http.Client  // client used for requests, its redirect policy is replaced (default: NewClient())
+}
+
+// DefaultProbeOptions returns the options used when fields of ProbeOptions are left unset.
+func DefaultProbeOptions() ProbeOptions {
+	return ProbeOptions{
+		Schemes:      []string{"https", "http"},
+		Ports:        []int{0},
+		Concurrency:  50,
+		Timeout:      10 * time.Second,
+		MaxRedirects: 10,
+		MaxBodySize:  1 << 20,
+	}
+}
+
+// ProbeResult is the outcome of probing a URL.
+type ProbeResult struct {
+	Input         string               `json:"input"` // target the URL was derived from
+	URL           string               `json:"url"`
+	Scheme        string               `json:"scheme"`
+	Port          string               `json:"port"`
+	StatusCode    int                  `json:"status_code,omitempty"`
+	FinalURL      string               `json:"final_url,omitempty"` // URL of the last response, if redirects were followed
+	Location      string               `json:"location,omitempty"`  // absolute Location of the last response
+	Title         string               `json:"title,omitempty"`
+	Server        string               `json:"server,omitempty"`
+	ContentType   string               `json:"content_type,omitempty"`
+	ContentLength int64                `json:"content_length"`
+	TLS           *ProbeTLS            `json:"tls,omitempty"`
+	ResponseTime  time.Duration        `json:"response_time"` // time until the response headers were received, in nanoseconds in JSON
+	Fingerprint   *ResponseFingerprint `json:"fingerprint,omitempty"`
+	Error         string               `json:"error,omitempty"` // reason the probe failed
+	Err           error                `json:"-"`
+}
+
+// ProbeTLS describes the TLS connection of a probed URL.
+type ProbeTLS struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	Subject     string    `json:"subject,omitempty"` // common name of the leaf certificate
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// Probe sends a GET request to each target and streams back the results. Targets are URLs,
+// which are probed as is, or hosts with an optional port and path, e.g. "example.com",
+// "10.0.0.1:8443" or "example.com/admin", which are probed with each of the configured
+// schemes, on each of the configured ports if they have none. The schemes of a host and
+// port are tried concurrently, and unless AllSchemes is set only the response of the most
+// preferred scheme is reported, or the failure of the most preferred scheme if none responds.
+// At most Concurrency targets are read from targets at a time. The returned channel is
+// closed once every target read from targets has been reported, or when ctx is done.
+func Probe(ctx context.Context, targets <-chan string, opts ProbeOptions) <-chan ProbeResult {
+	p := newProber(opts.withDefaults())
+	results := make(chan ProbeResult)
+
+	// Concurrency workers read the targets, so targets are only taken as fast as they are probed.
+	var wg sync.WaitGroup
+	for i := 0; i < p.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case target, ok := <-targets:
+					if !ok {
+						return
+					}
+					p.probeTarget(ctx, target, results)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// ProbeSlice is like Probe but takes its input from a slice.
+func ProbeSlice(ctx context.Context, targets []string, opts ProbeOptions) <-chan ProbeResult {
+	in := make(chan string)
+	go func() {
+		defer close(in)
+		for _, target := range targets {
+			select {
+			case in <- target:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return Probe(ctx, in, opts)
+}
+
+// WriteProbeResults writes results to w as JSON Lines, one object per line, until the
+// channel is closed. If writing fails, it returns the error without draining the channel,
+// so the caller should cancel the context of the probe.
+func WriteProbeResults(w io.Writer, results <-chan ProbeResult) error {
+	enc := json.NewEncoder(w)
+	for r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type prober struct {
+	opts   ProbeOptions
+	client *http.Client
+	err    error // error creating the default client, reported for every target
+	sem    chan struct{}
+}
+
+func newProber(opts ProbeOptions) *prober {
+	p := &prober{opts: opts, sem: make(chan struct{}, opts.Concurrency)}
+
+	client := opts.Client
+	if client == nil {
+		if client, p.err = NewClient(WithTimeout(opts.Timeout), WithKeepAlives(false)); p.err != nil {
+			return p
+		}
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !opts.FollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > opts.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+		}
+		return nil
+	}
+	p.client = &c
+	return p
+}
+
+// probeCandidate is a URL tried for a target.
+type probeCandidate struct {
+	url, scheme, port string
+}
+
+func (p *prober) probeTarget(ctx context.Context, target string, results chan<- ProbeResult) {
+	groups, err := p.candidates(target)
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		emitProbe(ctx, results, ProbeResult{Input: target, Err: err, Error: err.Error()})
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []probeCandidate) {
+			defer wg.Done()
+			p.probeGroup(ctx, target, group, results)
+		}(group)
+	}
+	wg.Wait()
+}
+
+// probeGroup probes the schemes of a host and port concurrently and reports the preferred result.
+func (p *prober) probeGroup(ctx context.Context, target string, group []probeCandidate, results chan<- ProbeResult) {
+	found := make([]ProbeResult, len(group))
+	var wg sync.WaitGroup
+	for i, c := range group {
+		wg.Add(1)
+		go func(i int, c probeCandidate) {
+			defer wg.Done()
+			found[i] = p.probeURL(ctx, target, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	reported := false
+	for _, r := range found {
+		if r.Err == nil {
+			emitProbe(ctx, results, r)
+			reported = true
+			if !p.opts.AllSchemes {
+				return
+			}
+		}
+	}
+	if !reported {
+		emitProbe(ctx, results, found[0])
+	}
+}
+
+func (p *prober) probeURL(ctx context.Context, target string, c probeCandidate) ProbeResult {
+	r := ProbeResult{Input: target, URL: c.url, Scheme: c.scheme, Port: c.port}
+	fail := func(err error) ProbeResult {
+		// Report the underlying error rather than `Get "<url>": ...`.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		r.Err, r.Error = err, err.Error()
+		return r
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+		defer func() { <-p.sem }()
+	case <-ctx.Done():
+		return fail(ctx.Err())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fail(err)
+	}
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+	r.ResponseTime = time.Since(start)
+
+	r.StatusCode = resp.StatusCode
+	r.Server = resp.Header.Get("Server")
+	r.ContentType = resp.Header.Get("Content-Type")
+	if final := resp.Request.URL.String(); final != c.url {
+		r.FinalURL = final
+	}
+	if location, err := resp.Location(); err == nil {
+		r.Location = location.String()
+	}
+	if resp.TLS != nil {
+		r.TLS = probeTLS(resp.TLS)
+	}
+
+	if p.opts.Fingerprint {
+		fp, err := FingerprintWithOptions(resp, FingerprintOptions{Client: p.client, MaxBodySize: p.opts.MaxBodySize})
+		if err != nil {
+			return fail(err)
+		}
+		r.Fingerprint = fp
+		r.Title, r.ContentLength = fp.Title, fp.ContentLength
+		return r
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.opts.MaxBodySize))
+	if err != nil {
+		return fail(err)
+	}
+	r.ContentLength = int64(len(body))
+	if int64(len(body)) == p.opts.MaxBodySize && resp.ContentLength > r.ContentLength {
+		r.ContentLength = resp.ContentLength
+	}
+	if isHTML(r.ContentType) {
+		if doc, err := html.Parse(bytes.NewReader(body)); err == nil {
+			r.Title = parsePage(doc).title
+		}
+	}
+	return r
+}
+
+// candidates returns the URLs to try for target, grouped by host and port.
+func (p *prober) candidates(target string) ([][]probeCandidate, error) {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL: %q", target)
+		}
+		port := u.Port()
+		if port == "" {
+			port = defaultPort(u.Scheme)
+		}
+		return [][]probeCandidate{{{url: target, scheme: u.Scheme, port: port}}}, nil
+	}
+
+	hostPort, path, _ := strings.Cut(target, "/")
+	if path != "" {
+		path = "/" + path
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = strings.Trim(hostPort, "[]")
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid target: %q", target)
+	}
+
+	ports := []string{port}
+	if port == "" {
+		ports = ports[:0]
+		for _, n := range p.opts.Ports {
+			if n == 0 {
+				ports = append(ports, "")
+			} else {
+				ports = append(ports, strconv.Itoa(n))
+			}
+		}
+	}
+
+	var groups [][]probeCandidate
+	for _, port := range ports {
+		var group []probeCandidate
+		for _, scheme := range p.opts.Schemes {
+			c := probeCandidate{scheme: scheme, port: port}
+			if port == "" {
+				c.port = defaultPort(scheme)
+				c.url = scheme + "://" + hostWithBrackets(host) + path
+			} else {
+				c.url = scheme + "://" + net.JoinHostPort(host, port) + path
+			}
+			group = append(group, c)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func probeTLS(state *tls.ConnectionState) *ProbeTLS {
+	t := &ProbeTLS{
+		Version:     netutil.TLSVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		t.Subject = cert.Subject.CommonName
+		t.DNSNames = cert.DNSNames
+		t.Issuer = cert.Issuer.CommonName
+		t.NotAfter = cert.NotAfter
+	}
+	return t
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+func hostWithBrackets(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+func emitProbe(ctx context.Context, results chan<- ProbeResult, r ProbeResult) {
+	select {
+	case results <- r:
+	case <-ctx.Done():
+	}
+}
+
+func (o ProbeOptions) withDefaults() ProbeOptions {
+	def := DefaultProbeOptions()
+	if len(o.Schemes) == 0 {
+		o.Schemes = def.Schemes
+	}
+	if len(o.Ports) == 0 {
+		o.Ports = def.Ports
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = def.Concurrency
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = def.Timeout
+	}
+	if o.MaxRedirects <= 0 {
+		o.MaxRedirects = def.MaxRedirects
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = def.MaxBodySize
+	}
+	return o
+}
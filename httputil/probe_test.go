@@ -0,0 +1,203 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newProbeServers(t *testing.T) (plain, secure *httptest.Server) {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		default:
+			w.Header().Set("Server", "probe-test")
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><head><title>Page %s</title></head></html>", r.URL.Path)
+		}
+	})
+	plain = httptest.NewServer(handler)
+	secure = httptest.NewTLSServer(handler)
+	t.Cleanup(plain.Close)
+	t.Cleanup(secure.Close)
+	return plain, secure
+}
+
+func hostPort(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func collectProbes(targets []string, opts ProbeOptions) []ProbeResult {
+	var results []ProbeResult
+	for r := range ProbeSlice(context.Background(), targets, opts) {
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestProbe(t *testing.T) {
+	plain, secure := newProbeServers(t)
+
+	results := collectProbes([]string{hostPort(t, plain) + "/index", hostPort(t, secure)}, ProbeOptions{})
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d: %+v", len(results), results)
+	}
+	byInput := make(map[string]ProbeResult)
+	for _, r := range results {
+		byInput[r.Input] = r
+	}
+
+	r := byInput[hostPort(t, plain)+"/index"]
+	if r.Err != nil || r.Scheme != "http" || r.URL != plain.URL+"/index" || r.StatusCode != http.StatusOK {
+		t.Errorf("Expected HTTP result for %s, got %+v", plain.URL, r)
+	}
+	if r.Title != "Page /index" || r.Server != "probe-test" || r.ContentType != "text/html" || r.ContentLength == 0 || r.TLS != nil {
+		t.Errorf("Expected response details, got %+v", r)
+	}
+
+	r = byInput[hostPort(t, secure)]
+	if r.Err != nil || r.Scheme != "https" || r.URL != secure.URL || r.TLS == nil || r.ResponseTime <= 0 {
+		t.Errorf("Expected HTTPS result for %s, got %+v", secure.URL, r)
+	}
+	if r.TLS != nil && (r.TLS.Version != "TLS 1.3" || r.TLS.CipherSuite == "" || r.TLS.NotAfter.IsZero()) {
+		t.Errorf("Expected TLS details, got %+v", r.TLS)
+	}
+}
+
+func TestProbeFailures(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	results := collectProbes([]string{closed, "ftp://example.com", ":80"}, ProbeOptions{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d: %+v", len(results), results)
+	}
+	for _, r := range results {
+		if r.Err == nil || r.Error == "" {
+			t.Errorf("Expected %s to fail, got %+v", r.Input, r)
+		}
+		if r.Input == closed && (r.Scheme != "https" || r.URL != "https://"+closed) {
+			t.Errorf("Expected the failure of the preferred scheme, got %+v", r)
+		}
+	}
+}
+
+func TestProbeOptions(t *testing.T) {
+	plain, secure := newProbeServers(t)
+
+	// Without FollowRedirects the redirect itself is reported.
+	results := collectProbes([]string{plain.URL + "/redirect"}, ProbeOptions{})
+	if len(results) != 1 || results[0].StatusCode != http.StatusFound || results[0].Location != plain.URL+"/final" || results[0].FinalURL != "" {
+		t.Errorf("Expected unfollowed redirect, got %+v", results)
+	}
+
+	results = collectProbes([]string{plain.URL + "/redirect"}, ProbeOptions{FollowRedirects: true, Fingerprint: true})
+	if len(results) != 1 || results[0].StatusCode != http.StatusOK || results[0].FinalURL != plain.URL+"/final" {
+		t.Errorf("Expected followed redirect, got %+v", results)
+	} else if results[0].Fingerprint == nil || results[0].Title != "Page /final" {
+		t.Errorf("Expected fingerprint, got %+v", results[0])
+	}
+
+	// A bare host is probed on every configured port, with the preferred scheme that responds.
+	ports := []int{plain.Listener.Addr().(*net.TCPAddr).Port, secure.Listener.Addr().(*net.TCPAddr).Port}
+	results = collectProbes([]string{"127.0.0.1"}, ProbeOptions{Ports: ports})
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d: %+v", len(results), results)
+	}
+	for _, r := range results {
+		want := "http"
+		if r.Port == strconv.Itoa(ports[1]) {
+			want = "https"
+		}
+		if r.Err != nil || r.Scheme != want {
+			t.Errorf("Expected %s on port %s, got %+v", want, r.Port, r)
+		}
+	}
+
+	// The TLS server also answers plain HTTP requests, with 400 Bad Request.
+	results = collectProbes([]string{"127.0.0.1"}, ProbeOptions{Ports: ports, AllSchemes: true})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d: %+v", len(results), results)
+	}
+}
+
+func TestProbeBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	targets := make(chan string)
+	results := Probe(context.Background(), targets, ProbeOptions{Concurrency: 2})
+	for i := 0; i < 2; i++ {
+		targets <- fmt.Sprintf("%s/%d", server.URL, i)
+	}
+	sent := 2
+	select {
+	case targets <- server.URL + "/2":
+		t.Errorf("Expected Probe to stop reading targets while Concurrency targets are in flight")
+		sent++
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	count := make(chan int)
+	go func() {
+		n := 0
+		for range results {
+			n++
+		}
+		count <- n
+	}()
+	if sent == 2 {
+		targets <- server.URL + "/2"
+	}
+	close(targets)
+	if n := <-count; n != 3 {
+		t.Errorf("Expected 3 results, got %d", n)
+	}
+}
+
+func TestWriteProbeResults(t *testing.T) {
+	plain, _ := newProbeServers(t)
+
+	var buf bytes.Buffer
+	results := ProbeSlice(context.Background(), []string{plain.URL + "/a", plain.URL + "/b"}, ProbeOptions{})
+	if err := WriteProbeResults(&buf, results); err != nil {
+		t.Fatalf("WriteProbeResults failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Errorf("Expected a JSON object, got %q: %v", line, err)
+		} else if r["status_code"] != float64(http.StatusOK) || !strings.HasPrefix(r["title"].(string), "Page /") {
+			t.Errorf("Expected status and title, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions configures a RateLimitTransport. Hosts are identified by the hostname of
+// the request URL, so requests to different ports of a host share its limits.
+type RateLimitOptions struct {
+	PerHost            float64       // requests per second to a single host, 0 for no limit
+	PerHostBurst       int           // requests to a single host that may be sent at once (default 1)
+	Global             float64       // requests per second across all hosts, 0 for no limit
+	GlobalBurst        int           // requests that may be sent at once across all hosts (default 1)
+	MaxInFlightPerHost int           // requests to a single host awaiting a response or being read, 0 for no limit
+	DefaultBackoff     time.Duration // how long a host is avoided after a 429 or 503 without Retry-After (default 30s)
+	MaxBackoff         time.Duration // upper bound on the backoff requested by Retry-After (default 5m)
+}
+
+// DefaultRateLimitOptions returns the options used when fields of RateLimitOptions are left unset.
+func DefaultRateLimitOptions() RateLimitOptions {
+	return RateLimitOptions{
+		PerHostBurst:   1,
+		GlobalBurst:    1,
+		DefaultBackoff: 30 * time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}
+}
+
+// RateLimitTransport is an http.RoundTripper that limits the rate of requests per host and
+// globally using token buckets, caps the number of in-flight requests per host, and stops
+// sending requests to a host that responded with 429 Too Many Requests or 503 Service
+// Unavailable for as long as its Retry-After header asks. Responses are returned unchanged.
+// It is safe for concurrent use.
+type RateLimitTransport struct {
+	base   http.RoundTripper
+	opts   RateLimitOptions
+	global *tokenBucket
+
+	mu      sync.Mutex
+	hosts   map[string]*hostLimiter
+	sweepAt int // number of hosts at which idle hosts are removed
+}
+
+// minHostSweep is the smallest number of hosts at which idle hosts are removed.
+const minHostSweep = 64
+
+type hostLimiter struct {
+	bucket   *tokenBucket
+	inflight chan struct{} // semaphore, nil for no limit
+	users    int           // requests using the limiter, guarded by RateLimitTransport.mu
+
+	mu           sync.Mutex
+	backoffUntil time.Time
+}
+
+// NewRateLimitTransport wraps base with rate limiting. If base is nil, http.DefaultTransport is used.
+func NewRateLimitTransport(base http.RoundTripper, opts RateLimitOptions) *RateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	opts = opts.withDefaults()
+	return &RateLimitTransport{
+		base:    base,
+		opts:    opts,
+		global:  newTokenBucket(opts.Global, opts.GlobalBurst),
+		hosts:   make(map[string]*hostLimiter),
+		sweepAt: minHostSweep,
+	}
+}
+
+// RoundTrip waits until the limits of the request's host allow it, then sends it.
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := t.acquire(strings.ToLower(req.URL.Hostname()))
+
+	if host.inflight != nil {
+		select {
+		case host.inflight <- struct{}{}:
+		case <-ctx.Done():
+			t.release(host)
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if host.inflight != nil {
+			<-host.inflight
+		}
+		t.release(host)
+	}
+
+	if err := t.wait(ctx, host); err != nil {
+		release()
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = t.opts.DefaultBackoff
+		}
+		if delay > t.opts.MaxBackoff {
+			delay = t.opts.MaxBackoff
+		}
+		host.backoff(time.Now().Add(delay))
+	}
+
+	// The request stays in flight until its body is closed.
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// wait blocks until host is no longer backed off and both token buckets allow a request.
+// Tokens are reserved from both buckets at once, and returned if ctx is done while waiting.
+func (t *RateLimitTransport) wait(ctx context.Context, host *hostLimiter) error {
+	for {
+		host.mu.Lock()
+		delay := time.Until(host.backoffUntil)
+		host.mu.Unlock()
+		if delay <= 0 {
+			break
+		}
+		// The backoff may have been extended while waiting, so check again.
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	delay := host.bucket.reserve()
+	if d := t.global.reserve(); d > delay {
+		delay = d
+	}
+	if delay <= 0 {
+		return nil
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		host.bucket.cancel()
+		t.global.cancel()
+		return err
+	}
+	return nil
+}
+
+// acquire returns the limiter of the host with the given name, which must be released once
+// the request is done. Idle limiters of other hosts are removed as the number of hosts grows.
+func (t *RateLimitTransport) acquire(name string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.hosts[name]
+	if !ok {
+		if len(t.hosts) >= t.sweepAt {
+			t.sweep()
+		}
+		h = &hostLimiter{bucket: newTokenBucket(t.opts.PerHost, t.opts.PerHostBurst)}
+		if t.opts.MaxInFlightPerHost > 0 {
+			h.inflight = make(chan struct{}, t.opts.MaxInFlightPerHost)
+		}
+		t.hosts[name] = h
+	}
+	h.users++
+	return h
+}
+
+func (t *RateLimitTransport) release(h *hostLimiter) {
+	t.mu.Lock()
+	h.users--
+	t.mu.Unlock()
+}
+
+// sweep removes the limiters of idle hosts, which behave the same as new ones. t.mu must be held.
+func (t *RateLimitTransport) sweep() {
+	now := time.Now()
+	for name, h := range t.hosts {
+		if h.idle(now) {
+			delete(t.hosts, name)
+		}
+	}
+	t.sweepAt = 2 * len(t.hosts)
+	if t.sweepAt < minHostSweep {
+		t.sweepAt = minHostSweep
+	}
+}
+
+// idle reports whether no request uses h, its backoff is over and its bucket is full.
+func (h *hostLimiter) idle(now time.Time) bool {
+	if h.users > 0 {
+		return false
+	}
+	h.mu.Lock()
+	backedOff := now.Before(h.backoffUntil)
+	h.mu.Unlock()
+	return !backedOff && h.bucket.full(now)
+}
+
+func (h *hostLimiter) backoff(until time.Time) {
+	h.mu.Lock()
+	if until.After(h.backoffUntil) {
+		h.backoffUntil = until
+	}
+	h.mu.Unlock()
+}
+
+// tokenBucket allows rate events per second on average with bursts of up to burst events.
+// A nil *tokenBucket allows everything.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+// If the token is not used, it must be returned with cancel.
+func (b *tokenBucket) reserve() time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token taken with reserve.
+func (b *tokenBucket) cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// full reports whether the bucket will have refilled completely by now.
+func (b *tokenBucket) full(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseBody calls release once when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (o RateLimitOptions) withDefaults() RateLimitOptions {
+	def := DefaultRateLimitOptions()
+	if o.PerHostBurst <= 0 {
+		o.PerHostBurst = def.PerHostBurst
+	}
+	if o.GlobalBurst <= 0 {
+		o.GlobalBurst = def.GlobalBurst
+	}
+	if o.DefaultBackoff <= 0 {
+		o.DefaultBackoff = def.DefaultBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = def.MaxBackoff
+	}
+	return o
+}
@@ -0,0 +1,223 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestRateLimitTransportPerHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, RateLimitOptions{PerHost: 20})}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		get(t, client, server.URL)
+	}
+	// The first request is sent at once, the other four 50ms apart.
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("5 requests at 20/s took %v; want at least 200ms", elapsed)
+	}
+
+	start = time.Now()
+	get(t, client, otherHost)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Request to another host took %v; want no delay", elapsed)
+	}
+}
+
+func TestRateLimitTransportGlobal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, RateLimitOptions{Global: 20, GlobalBurst: 2})}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		get(t, client, server.URL)
+		get(t, client, otherHost)
+	}
+	// Two requests are sent at once, the other four 50ms apart.
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("6 requests at 20/s took %v; want at least 200ms", elapsed)
+	}
+}
+
+func TestRateLimitTransportInFlight(t *testing.T) {
+	var inflight, maxInflight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, RateLimitOptions{MaxInFlightPerHost: 2})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("Failed to make GET request: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&maxInflight); n != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", n)
+	}
+}
+
+func TestRateLimitTransportRetryAfter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, RateLimitOptions{MaxBackoff: 300 * time.Millisecond})}
+
+	if resp := get(t, client, server.URL); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	start := time.Now()
+	get(t, client, otherHost)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Request to another host took %v; want no delay", elapsed)
+	}
+
+	start = time.Now()
+	if resp := get(t, client, server.URL); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	// Retry-After is capped by MaxBackoff.
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Request after 429 took %v; want about 300ms", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseRetryAfter(test.value, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRateLimitTransportCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	client := &http.Client{Transport: NewRateLimitTransport(nil, RateLimitOptions{PerHost: 1, Global: 10})}
+	get(t, client, otherHost)
+
+	// The request is cancelled while waiting for the global bucket, so its host token is returned.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatalf("Expected the request to be cancelled")
+	}
+
+	start := time.Now()
+	get(t, client, server.URL)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Request after a cancelled one took %v; want the host token to be returned", elapsed)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitTransportIdleHosts(t *testing.T) {
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+	transport := NewRateLimitTransport(base, RateLimitOptions{PerHost: 1000, MaxInFlightPerHost: 1})
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 4*minHostSweep; i++ {
+		get(t, client, fmt.Sprintf("http://host%d.test/", i))
+		time.Sleep(time.Millisecond)
+	}
+
+	// A host that is backed off is kept.
+	transport.acquire("busy.test").backoff(time.Now().Add(time.Hour))
+	transport.release(transport.hosts["busy.test"])
+	transport.mu.Lock()
+	transport.sweep()
+	_, kept := transport.hosts["busy.test"]
+	n := len(transport.hosts)
+	transport.mu.Unlock()
+
+	if n > minHostSweep || !kept {
+		t.Errorf("Expected idle hosts to be removed and busy.test to be kept, got %d hosts (busy.test kept: %v)", n, kept)
+	}
+}
@@ -0,0 +1,264 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/root4loot/goutils/domainutil"
+	"golang.org/x/net/html"
+)
+
+// RedirectType is the mechanism by which a response redirects.
+type RedirectType string
+
+// Redirect mechanisms, in the order they are looked for.
+const (
+	RedirectLocation    RedirectType = "location"     // 3xx status with a Location header
+	RedirectRefresh     RedirectType = "refresh"      // Refresh header
+	RedirectMetaRefresh RedirectType = "meta-refresh" // <meta http-equiv="refresh"> tag
+	RedirectJavaScript  RedirectType = "javascript"   // location assignment in an inline script
+)
+
+// RedirectHop is a single request of a redirect chain.
+type RedirectHop struct {
+	URL         string       `json:"url"`
+	StatusCode  int          `json:"status_code"`
+	Header      http.Header  `json:"header"`
+	Type        RedirectType `json:"type,omitempty"`         // how this hop redirects, empty for the last hop
+	Location    string       `json:"location,omitempty"`     // absolute URL this hop redirects to
+	CrossDomain bool         `json:"cross_domain,omitempty"` // Location is on a different registrable domain
+}
+
+// RedirectTrace is the outcome of TraceRedirects.
+type RedirectTrace struct {
+	Hops         []RedirectHop `json:"hops"`
+	FinalURL     string        `json:"final_url"`     // URL of the last hop
+	Loop         bool          `json:"loop"`          // the last hop redirects to a URL visited before
+	LimitReached bool          `json:"limit_reached"` // tracing stopped at MaxHops while still redirecting
+	CrossDomain  bool          `json:"cross_domain"`  // some hop redirects to a different registrable domain
+}
+
+// TraceOptions configures TraceRedirects.
+type TraceOptions struct {
+	MaxHops     int          // maximum number of requests (default 10)
+	MaxBodySize int64        // bytes of each body searched for meta refresh and JavaScript redirects (default 1MB)
+	Client      *http.Client // client used for requests, its redirect policy is ignored (default: a shared client from NewClient())
+}
+
+// DefaultTraceOptions returns the options used when fields of TraceOptions are left unset.
+func DefaultTraceOptions() TraceOptions {
+	return TraceOptions{
+		MaxHops:     10,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+var jsRedirectRegex = regexp.MustCompile(`(?:^|[^\w$.])(?:(?:window|document|top|self)\.)?location(?:(?:\.href)?\s*=\s*["']([^"']+)["']|\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\))`)
+
+// TraceRedirects requests target and follows its redirects hop by hop: Location headers of
+// 3xx responses, Refresh headers, meta refresh tags and simple JavaScript location assignments.
+// Tracing stops at a response that does not redirect, at a URL visited before, or after MaxHops
+// requests. If a request fails, the hops traced so far are returned along with the error.
+func TraceRedirects(ctx context.Context, target string, opts TraceOptions) (*RedirectTrace, error) {
+	opts = opts.withDefaults()
+	client := opts.Client
+	if client == nil {
+		var err error
+		if client, err = sharedClient(); err != nil {
+			return nil, err
+		}
+	}
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	current, err := url.Parse(target)
+	if err != nil || (current.Scheme != "http" && current.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL: %q", target)
+	}
+
+	trace := &RedirectTrace{}
+	visited := make(map[string]bool)
+	current.Fragment = ""
+	for {
+		visited[current.String()] = true
+		trace.FinalURL = current.String()
+
+		hop, next, err := traceHop(ctx, &noFollow, current, opts.MaxBodySize)
+		if err != nil {
+			return trace, err
+		}
+		trace.Hops = append(trace.Hops, hop)
+		if next == nil {
+			return trace, nil
+		}
+
+		last := &trace.Hops[len(trace.Hops)-1]
+		last.CrossDomain = !sameSite(current.Hostname(), next.Hostname())
+		trace.CrossDomain = trace.CrossDomain || last.CrossDomain
+
+		if visited[next.String()] {
+			trace.Loop = true
+			return trace, nil
+		}
+		if len(trace.Hops) >= opts.MaxHops {
+			trace.LimitReached = true
+			return trace, nil
+		}
+		current = next
+	}
+}
+
+// traceHop requests u and returns the hop along with the URL it redirects to, if any.
+func traceHop(ctx context.Context, client *http.Client, u *url.URL, maxBodySize int64) (RedirectHop, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return RedirectHop{}, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return RedirectHop{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	hop := RedirectHop{URL: u.String(), StatusCode: resp.StatusCode, Header: resp.Header}
+
+	var location string
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		hop.Type, location = RedirectLocation, resp.Header.Get("Location")
+	case resp.Header.Get("Refresh") != "":
+		if target, ok := parseRefresh(resp.Header.Get("Refresh")); ok {
+			hop.Type, location = RedirectRefresh, target
+		}
+	}
+	if hop.Type == "" && isHTML(resp.Header.Get("Content-Type")) {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return RedirectHop{}, nil, err
+		}
+		hop.Type, location = bodyRedirect(string(body))
+	}
+	if hop.Type == "" {
+		return hop, nil, nil
+	}
+
+	next, err := u.Parse(strings.TrimSpace(location))
+	if err != nil || (next.Scheme != "http" && next.Scheme != "https") {
+		// Redirects to unparseable or non-HTTP URLs end the chain.
+		hop.Type = ""
+		return hop, nil, nil
+	}
+	next.Fragment = ""
+	hop.Location = next.String()
+	return hop, next, nil
+}
+
+// bodyRedirect looks for a meta refresh tag, then for a JavaScript location assignment in inline scripts.
+func bodyRedirect(body string) (RedirectType, string) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", ""
+	}
+
+	var scripts []string
+	var meta string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "meta":
+				var refresh bool
+				var content string
+				for _, a := range n.Attr {
+					if strings.EqualFold(a.Key, "http-equiv") && strings.EqualFold(a.Val, "refresh") {
+						refresh = true
+					} else if strings.EqualFold(a.Key, "content") {
+						content = a.Val
+					}
+				}
+				if target, ok := parseRefresh(content); refresh && ok && meta == "" {
+					meta = target
+				}
+			case "script":
+				if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+					scripts = append(scripts, n.FirstChild.Data)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if meta != "" {
+		return RedirectMetaRefresh, meta
+	}
+	for _, script := range scripts {
+		if m := jsRedirectRegex.FindStringSubmatch(script); m != nil {
+			if m[1] != "" {
+				return RedirectJavaScript, m[1]
+			}
+			return RedirectJavaScript, m[2]
+		}
+	}
+	return "", ""
+}
+
+// parseRefresh extracts the URL of a Refresh header or meta refresh content,
+// e.g. "5; url='https://example.com/'".
+func parseRefresh(value string) (string, bool) {
+	i := strings.IndexAny(value, ";,")
+	if i < 0 {
+		return "", false
+	}
+	rest := strings.TrimSpace(value[i+1:])
+	if name, target, ok := strings.Cut(rest, "="); ok && strings.EqualFold(strings.TrimSpace(name), "url") {
+		rest = strings.TrimSpace(target)
+	}
+	rest = strings.Trim(rest, `"'`)
+	return rest, rest != ""
+}
+
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// sameSite reports whether two hosts share a registrable domain. Hosts without one, such as
+// IP addresses, must be equal.
+func sameSite(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	if net.ParseIP(a) != nil || net.ParseIP(b) != nil {
+		return false
+	}
+	rootA, errA := domainutil.RegistrableDomain(a)
+	rootB, errB := domainutil.RegistrableDomain(b)
+	return errA == nil && errB == nil && rootA == rootB
+}
+
+func (o TraceOptions) withDefaults() TraceOptions {
+	def := DefaultTraceOptions()
+	if o.MaxHops <= 0 {
+		o.MaxHops = def.MaxHops
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = def.MaxBodySize
+	}
+	return o
+}
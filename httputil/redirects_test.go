@@ -0,0 +1,186 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/refresh", http.StatusMovedPermanently)
+		case "/refresh":
+			w.Header().Set("Refresh", "0; url=/meta")
+			w.WriteHeader(http.StatusOK)
+		case "/meta":
+			fmt.Fprint(w, `<html><head><meta http-equiv="Refresh" content="0; URL='/js'"></head></html>`)
+		case "/js":
+			fmt.Fprint(w, `<html><body><p>location = "/nowhere"</p><script>window.location.href = '/final#top';</script></body></html>`)
+		case "/final":
+			fmt.Fprint(w, `<html><body>done</body></html>`)
+		case "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		case "/external":
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/final", http.StatusFound)
+		case "/mailto":
+			http.Redirect(w, r, "mailto:admin@example.com", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTraceRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+
+	trace, err := TraceRedirects(context.Background(), server.URL+"/start", TraceOptions{})
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+
+	want := []struct {
+		path     string
+		status   int
+		redirect RedirectType
+		nextPath string
+	}{
+		{"/start", http.StatusMovedPermanently, RedirectLocation, "/refresh"},
+		{"/refresh", http.StatusOK, RedirectRefresh, "/meta"},
+		{"/meta", http.StatusOK, RedirectMetaRefresh, "/js"},
+		{"/js", http.StatusOK, RedirectJavaScript, "/final"},
+		{"/final", http.StatusOK, "", ""},
+	}
+	if len(trace.Hops) != len(want) {
+		t.Fatalf("TraceRedirects returned %d hops; want %d: %+v", len(trace.Hops), len(want), trace.Hops)
+	}
+	for i, w := range want {
+		hop := trace.Hops[i]
+		wantLocation := ""
+		if w.nextPath != "" {
+			wantLocation = server.URL + w.nextPath
+		}
+		if hop.URL != server.URL+w.path || hop.StatusCode != w.status || hop.Type != w.redirect || hop.Location != wantLocation {
+			t.Errorf("Hops[%d] = %s %d %q -> %s; want %s %d %q -> %s", i, hop.URL, hop.StatusCode, hop.Type, hop.Location, server.URL+w.path, w.status, w.redirect, wantLocation)
+		}
+	}
+	if trace.FinalURL != server.URL+"/final" || trace.Loop || trace.LimitReached || trace.CrossDomain {
+		t.Errorf("TraceRedirects returned %+v", trace)
+	}
+	if trace.Hops[0].Header.Get("Location") != "/refresh" {
+		t.Errorf("Expected hop headers to be recorded")
+	}
+}
+
+func TestTraceRedirectsStops(t *testing.T) {
+	server := newRedirectServer(t)
+
+	trace, err := TraceRedirects(context.Background(), server.URL+"/loop-a", TraceOptions{})
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+	if !trace.Loop || len(trace.Hops) != 2 {
+		t.Errorf("Expected a loop after 2 hops, got loop=%v after %d", trace.Loop, len(trace.Hops))
+	}
+
+	trace, err = TraceRedirects(context.Background(), server.URL+"/start", TraceOptions{MaxHops: 2})
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+	if !trace.LimitReached || len(trace.Hops) != 2 || trace.FinalURL != server.URL+"/refresh" {
+		t.Errorf("Expected limit after 2 hops, got %+v", trace)
+	}
+
+	trace, err = TraceRedirects(context.Background(), server.URL+"/external", TraceOptions{})
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+	if !trace.CrossDomain || !trace.Hops[0].CrossDomain || len(trace.Hops) != 2 {
+		t.Errorf("Expected a cross-domain hop, got %+v", trace)
+	}
+
+	trace, err = TraceRedirects(context.Background(), server.URL+"/mailto", TraceOptions{})
+	if err != nil {
+		t.Fatalf("TraceRedirects failed: %v", err)
+	}
+	if len(trace.Hops) != 1 || trace.Hops[0].Type != "" {
+		t.Errorf("Expected non-HTTP redirect to end the chain, got %+v", trace.Hops)
+	}
+
+	if _, err := TraceRedirects(context.Background(), "ftp://example.com", TraceOptions{}); err == nil {
+		t.Errorf("Expected error for non-HTTP URL")
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"0; url=https://example.com/", "https://example.com/", true},
+		{"5;URL='/next'", "/next", true},
+		{`3; Url = "/quoted"`, "/quoted", true},
+		{"0; /plain?a=b", "/plain?a=b", true},
+		{"10", "", false},
+		{"0;", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseRefresh(test.value)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseRefresh(%q) = %q, %v; want %q, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBodyRedirect(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{`window.location.href = '/a';`, "/a"},
+		{`location="/b"`, "/b"},
+		{`if (x) { top.location = "/c"; }`, "/c"},
+		{`location.replace('/d')`, "/d"},
+		{`var relocation = '/e';`, ""},
+		{`myLocation.href = "/f";`, ""},
+		{`mylocation.href = "/g";`, ""},
+		{`config.location = "/h";`, ""},
+	}
+	for _, test := range tests {
+		_, got := bodyRedirect("<script>" + test.script + "</script>")
+		if got != test.want {
+			t.Errorf("bodyRedirect(%q) = %q; want %q", test.script, got, test.want)
+		}
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"www.example.com", "example.com", true},
+		{"a.example.co.uk", "b.example.co.uk", true},
+		{"example.com", "example.org", false},
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.1", "192.168.0.1", false},
+		{"::1", "10.0.0.1", false},
+	}
+	for _, test := range tests {
+		if got := sameSite(test.a, test.b); got != test.want {
+			t.Errorf("sameSite(%q, %q) = %v; want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
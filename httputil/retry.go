@@ -0,0 +1,202 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryOptions configures a RetryTransport.
+type RetryOptions struct {
+	MaxRetries         int           // retries after the first attempt (default 3, negative for none)
+	MinBackoff         time.Duration // backoff before the first retry, doubled for each further retry (default 200ms)
+	MaxBackoff         time.Duration // upper bound on the backoff, including Retry-After (default 10s)
+	RetryStatus        []int         // response status codes that are retried (default 429, 502, 503, 504)
+	RetryNonIdempotent bool          // also retry methods such as POST and PATCH
+}
+
+// DefaultRetryOptions returns the options used when fields of RetryOptions are left unset.
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxRetries:  3,
+		MinBackoff:  200 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		RetryStatus: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// RetryTransport is an http.RoundTripper that retries requests failing with connection resets
+// or timeouts, or with one of the RetryStatus codes, using jittered exponential backoff. Only
+// idempotent requests are retried unless RetryNonIdempotent is set; requests with an
+// Idempotency-Key header count as idempotent. Request bodies are replayed using GetBody, or
+// buffered in memory if it is not set. A retry that would not start before the deadline of
+// the request's context is not attempted. Use RetryAttempts to get the number of attempts
+// made for a response. It is safe for concurrent use.
+type RetryTransport struct {
+	base        http.RoundTripper
+	opts        RetryOptions
+	retryStatus map[int]bool
+}
+
+type retryAttemptsKey struct{}
+
+// NewRetryTransport wraps base with retries. If base is nil, http.DefaultTransport is used.
+func NewRetryTransport(base http.RoundTripper, opts RetryOptions) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	opts = opts.withDefaults()
+	t := &RetryTransport{base: base, opts: opts, retryStatus: make(map[int]bool)}
+	for _, status := range opts.RetryStatus {
+		t.retryStatus[status] = true
+	}
+	return t
+}
+
+// RetryAttempts returns the number of attempts a RetryTransport made to obtain resp,
+// or 0 if the response did not pass through one.
+func RetryAttempts(resp *http.Response) int {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	if n, ok := resp.Request.Context().Value(retryAttemptsKey{}).(*int32); ok {
+		return int(atomic.LoadInt32(n))
+	}
+	return 0
+}
+
+// RoundTrip sends req, retrying it as configured.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := new(int32)
+	ctx := context.WithValue(req.Context(), retryAttemptsKey{}, attempts)
+
+	maxRetries := t.opts.MaxRetries
+	if !t.opts.RetryNonIdempotent && !isIdempotent(req) {
+		maxRetries = 0
+	}
+	if maxRetries > 0 && req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		req = req.Clone(req.Context())
+		if err := bufferBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	for retry := 0; ; retry++ {
+		attemptReq := req.WithContext(ctx)
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		atomic.AddInt32(attempts, 1)
+		resp, err := t.base.RoundTrip(attemptReq)
+		if retry >= maxRetries || ctx.Err() != nil || !t.shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(retry)
+		if resp != nil {
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && after > delay {
+				delay = after
+				if delay > t.opts.MaxBackoff {
+					delay = t.opts.MaxBackoff
+				}
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			// Drain a little of the body so that the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *RetryTransport) shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return isRetryableError(err)
+	}
+	return t.retryStatus[resp.StatusCode]
+}
+
+// backoff returns the delay before the given retry (starting at 0): MinBackoff doubled
+// retry times, capped at MaxBackoff, with up to half of it replaced by random jitter.
+func (t *RetryTransport) backoff(retry int) time.Duration {
+	d := t.opts.MinBackoff
+	for i := 0; i < retry && d < t.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > t.opts.MaxBackoff {
+		d = t.opts.MaxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isRetryableError reports whether err is a connection reset, an unexpected end of the
+// connection or a timeout.
+func isRetryableError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// bufferBody reads the body of req into memory and sets GetBody so that it can be replayed.
+func bufferBody(req *http.Request) error {
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	def := DefaultRetryOptions()
+	if o.MaxRetries == 0 {
+		o.MaxRetries = def.MaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = def.MinBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = def.MaxBackoff
+	}
+	if o.RetryStatus == nil {
+		o.RetryStatus = def.RetryStatus
+	}
+	return o
+}
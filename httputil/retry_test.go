@@ -0,0 +1,175 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer responds with status to the first failures requests and with 200 OK afterwards.
+// It records the body of every request.
+func failingServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32, chan string) {
+	t.Helper()
+	var requests int32
+	bodies := make(chan string, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, bodies
+}
+
+func TestRetryTransportStatus(t *testing.T) {
+	server, _, _ := failingServer(t, 2, http.StatusServiceUnavailable)
+	client := &http.Client{Transport: NewRetryTransport(nil, RetryOptions{MinBackoff: time.Millisecond})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if n := RetryAttempts(resp); n != 3 {
+		t.Errorf("RetryAttempts() = %d; want 3", n)
+	}
+}
+
+func TestRetryTransportExhausted(t *testing.T) {
+	server, requests, _ := failingServer(t, 100, http.StatusBadGateway)
+	client := &http.Client{Transport: NewRetryTransport(nil, RetryOptions{MaxRetries: 2, MinBackoff: time.Millisecond})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 || RetryAttempts(resp) != 3 {
+		t.Errorf("Expected 3 attempts, server saw %d and RetryAttempts() = %d", n, RetryAttempts(resp))
+	}
+}
+
+func TestRetryTransportIdempotency(t *testing.T) {
+	tests := []struct {
+		name         string
+		idempotency  string
+		retryAll     bool
+		wantAttempts int
+	}{
+		{"POST", "", false, 1},
+		{"POST with Idempotency-Key", "abc", false, 2},
+		{"POST with RetryNonIdempotent", "", true, 2},
+	}
+
+	for _, test := range tests {
+		server, _, bodies := failingServer(t, 1, http.StatusServiceUnavailable)
+		client := &http.Client{Transport: NewRetryTransport(nil, RetryOptions{MinBackoff: time.Millisecond, RetryNonIdempotent: test.retryAll})}
+
+		// A reader without a known length, so that http.NewRequest does not set GetBody.
+		req, _ := http.NewRequest(http.MethodPost, server.URL, io.MultiReader(strings.NewReader("payload")))
+		if test.idempotency != "" {
+			req.Header.Set("Idempotency-Key", test.idempotency)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp.Body.Close()
+
+		if n := RetryAttempts(resp); n != test.wantAttempts {
+			t.Errorf("%s: RetryAttempts() = %d; want %d", test.name, n, test.wantAttempts)
+		}
+		close(bodies)
+		for body := range bodies {
+			if body != "payload" {
+				t.Errorf("%s: server received body %q; want %q", test.name, body, "payload")
+			}
+		}
+	}
+}
+
+func TestRetryTransportConnectionReset(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil, RetryOptions{MinBackoff: time.Millisecond})}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || RetryAttempts(resp) != 2 {
+		t.Errorf("Expected 200 after 2 attempts, got %d after %d", resp.StatusCode, RetryAttempts(resp))
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	server, requests, _ := failingServer(t, 100, http.StatusServiceUnavailable)
+	client := &http.Client{Transport: NewRetryTransport(nil, RetryOptions{MinBackoff: time.Second})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	// The backoff of at least 500ms does not fit before the deadline, so the 503 is returned at once.
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("Request took %v; want no retry", elapsed)
+	}
+	if n := atomic.LoadInt32(requests); n != 1 || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a single 503, got %d requests and status %d", n, resp.StatusCode)
+	}
+}
+
+func TestRetryTransportBackoff(t *testing.T) {
+	transport := NewRetryTransport(nil, RetryOptions{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if d := transport.backoff(test.retry); d < test.min || d > test.max {
+				t.Errorf("backoff(%d) = %v; want between %v and %v", test.retry, d, test.min, test.max)
+			}
+		}
+	}
+}
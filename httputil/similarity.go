@@ -0,0 +1,518 @@
+package httputil
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dynamicTokenRegexes match values that change between otherwise identical responses.
+var dynamicTokenRegexes = []*regexp.Regexp{
+	// ISO 8601 timestamps and dates, e.g. 2024-05-01T12:30:00.123Z
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?)?`),
+	// HTTP dates, e.g. Wed, 01 May 2024 12:30:00 GMT
+	regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{4} \d{2}:\d{2}:\d{2} GMT`),
+	// Times of day, e.g. 12:30:00
+	regexp.MustCompile(`\b\d{1,2}:\d{2}:\d{2}\b`),
+	// UUIDs
+	regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+	// Unix timestamps in seconds or milliseconds
+	regexp.MustCompile(`\b1\d{9}(?:\d{3})?\b`),
+	// Hex digests, nonces and session IDs
+	regexp.MustCompile(`(?i)\b[0-9a-f]{16,}\b`),
+}
+
+// base64TokenRegex matches candidates for base64, base64url and JWT tokens, which are only
+// removed if they mix digits, lowercase and uppercase letters, unlike long paths and slugs.
+var base64TokenRegex = regexp.MustCompile(`[A-Za-z0-9+/_.-]{32,}={0,2}`)
+
+var (
+	// tokenTagRegex matches input and meta tags that carry CSRF tokens or nonces.
+	tokenTagRegex  = regexp.MustCompile(`(?i)<(?:input|meta)\b[^>]*(?:csrf|xsrf|token|nonce|authenticity)[^>]*>`)
+	tokenAttrRegex = regexp.MustCompile(`(?i)\b(value|content)\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+	nonceAttrRegex = regexp.MustCompile(`(?i)\bnonce\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// NormalizeBody removes values from body that differ between requests for the same page:
+// timestamps, dates, UUIDs, long hex and base64 tokens, CSRF token fields and script nonces.
+func NormalizeBody(body []byte) []byte {
+	s := tokenTagRegex.ReplaceAllStringFunc(string(body), func(tag string) string {
+		return tokenAttrRegex.ReplaceAllString(tag, `$1=""`)
+	})
+	s = nonceAttrRegex.ReplaceAllString(s, `nonce=""`)
+	for _, re := range dynamicTokenRegexes {
+		s = re.ReplaceAllString(s, "")
+	}
+	s = base64TokenRegex.ReplaceAllStringFunc(s, func(token string) string {
+		if strings.ContainsAny(token, "0123456789") &&
+			strings.ContainsAny(token, "abcdefghijklmnopqrstuvwxyz") &&
+			strings.ContainsAny(token, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+			return ""
+		}
+		return token
+	})
+	return []byte(s)
+}
+
+// SimHash returns a 64-bit similarity hash of body after NormalizeBody. The hashes of similar
+// bodies differ in few bits, see SimHashDistance. Bodies are compared by their words, in order.
+func SimHash(body []byte) uint64 {
+	return simhash(strings.Fields(string(NormalizeBody(body))))
+}
+
+// SimHashDistance returns the number of bits in which two similarity hashes differ,
+// from 0 for similar bodies to about 32 for unrelated ones.
+func SimHashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// simhash hashes the shingles of three consecutive tokens, or the tokens themselves if
+// there are fewer than three.
+func simhash(tokens []string) uint64 {
+	const shingle = 3
+
+	var weights [64]int
+	add := func(feature []string) {
+		h := fnv.New64a()
+		for _, token := range feature {
+			h.Write([]byte(token))
+			h.Write([]byte{0})
+		}
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(tokens) < shingle {
+		for _, token := range tokens {
+			add([]string{token})
+		}
+	}
+	for i := 0; i+shingle <= len(tokens); i++ {
+		add(tokens[i : i+shingle])
+	}
+
+	var hash uint64
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// Parameters of the context triggered piecewise hash used by FuzzyHash, as in ssdeep.
+const (
+	spamsumLength = 64
+	minBlockSize  = 3
+	rollingWindow = 7
+	fuzzyPrime    = 0x01000193
+	fuzzyInit     = 0x28021967
+	fuzzyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// FuzzyHash returns an ssdeep-style context triggered piecewise hash of body after
+// NormalizeBody, in the form "blocksize:signature:signature". Unlike a similarity hash, it
+// also matches bodies of which one contains large parts of the other. Compare hashes with
+// FuzzyCompare.
+func FuzzyHash(body []byte) string {
+	data := NormalizeBody(body)
+	blockSize := uint32(minBlockSize)
+	for uint64(blockSize)*spamsumLength < uint64(len(data)) {
+		blockSize *= 2
+	}
+	for {
+		sig1, sig2 := fuzzySignatures(data, blockSize)
+		if blockSize > minBlockSize && len(sig1) < spamsumLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, sig1, sig2)
+	}
+}
+
+// fuzzySignatures hashes data in pieces delimited where the rolling hash hits the block size,
+// and in pieces twice as long.
+func fuzzySignatures(data []byte, blockSize uint32) (string, string) {
+	var roll rollingHash
+	var sig1, sig2 []byte
+	var r uint32
+	h1, h2 := uint32(fuzzyInit), uint32(fuzzyInit)
+	for _, c := range data {
+		h1 = h1*fuzzyPrime ^ uint32(c)
+		h2 = h2*fuzzyPrime ^ uint32(c)
+		r = roll.update(c)
+		if r%blockSize != blockSize-1 {
+			continue
+		}
+		if len(sig1) < spamsumLength-1 {
+			sig1 = append(sig1, fuzzyAlphabet[h1%64])
+			h1 = fuzzyInit
+		}
+		if r%(blockSize*2) == blockSize*2-1 && len(sig2) < spamsumLength/2-1 {
+			sig2 = append(sig2, fuzzyAlphabet[h2%64])
+			h2 = fuzzyInit
+		}
+	}
+	if r != 0 {
+		sig1 = append(sig1, fuzzyAlphabet[h1%64])
+		sig2 = append(sig2, fuzzyAlphabet[h2%64])
+	}
+	return string(sig1), string(sig2)
+}
+
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) update(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%rollingWindow])
+	r.window[r.n%rollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+	return r.h1 + r.h2 + r.h3
+}
+
+// FuzzyCompare returns how similar the bodies of two FuzzyHash results are, from 0 for
+// unrelated bodies to 100 for identical ones. Hashes whose block sizes are more than a factor
+// of two apart always score 0.
+func FuzzyCompare(a, b string) (int, error) {
+	sizeA, a1, a2, err := parseFuzzyHash(a)
+	if err != nil {
+		return 0, err
+	}
+	sizeB, b1, b2, err := parseFuzzyHash(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case sizeA == sizeB:
+		if a1 == b1 && a2 == b2 {
+			return 100, nil
+		}
+		score := scoreSignatures(a1, b1, sizeA)
+		if s := scoreSignatures(a2, b2, sizeA*2); s > score {
+			score = s
+		}
+		return score, nil
+	case sizeA == sizeB*2:
+		return scoreSignatures(a1, b2, sizeA), nil
+	case sizeB == sizeA*2:
+		return scoreSignatures(a2, b1, sizeB), nil
+	}
+	return 0, nil
+}
+
+func parseFuzzyHash(hash string) (uint32, string, string, error) {
+	parts := strings.Split(hash, ":")
+	if len(parts) != 3 {
+		return 0, "", "", fmt.Errorf("invalid fuzzy hash: %q", hash)
+	}
+	blockSize, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || blockSize < minBlockSize {
+		return 0, "", "", fmt.Errorf("invalid fuzzy hash: %q", hash)
+	}
+	return uint32(blockSize), collapseRuns(parts[1]), collapseRuns(parts[2]), nil
+}
+
+// collapseRuns shortens runs of more than three identical characters, which carry little information.
+func collapseRuns(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// scoreSignatures scores two signatures of the same block size by their edit distance. Without
+// a common substring of rollingWindow characters they score 0, and for small block sizes the
+// score is capped so that short inputs do not appear more similar than they can be shown to be.
+func scoreSignatures(a, b string, blockSize uint32) int {
+	if len(a) == 0 || len(b) == 0 || !hasCommonSubstring(a, b, rollingWindow) {
+		return 0
+	}
+	score := editDistance(a, b) * spamsumLength / (len(a) + len(b))
+	score = 100 * score / spamsumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	if blockSize >= (99+rollingWindow-1)/rollingWindow*minBlockSize {
+		return score
+	}
+	limit := int(blockSize) / minBlockSize * len(a)
+	if len(b) < len(a) {
+		limit = int(blockSize) / minBlockSize * len(b)
+	}
+	if score > limit {
+		return limit
+	}
+	return score
+}
+
+func hasCommonSubstring(a, b string, n int) bool {
+	if len(a) < n || len(b) < n {
+		return false
+	}
+	seen := make(map[string]bool, len(a)-n+1)
+	for i := 0; i+n <= len(a); i++ {
+		seen[a[i:i+n]] = true
+	}
+	for i := 0; i+n <= len(b); i++ {
+		if seen[b[i:i+n]] {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance of a and b, with substitutions costing 2.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := prev[j-1]
+			if a[i-1] != b[j-1] {
+				cost += 2
+			}
+			if prev[j]+1 < cost {
+				cost = prev[j] + 1
+			}
+			if cur[j-1]+1 < cost {
+				cost = cur[j-1] + 1
+			}
+			cur[j] = cost
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// DiffOptions configures DiffResponsesWithOptions.
+type DiffOptions struct {
+	MaxBodySize   int64    // bytes of each body compared (default 1MB)
+	IgnoreHeaders []string // headers not compared (default: Date, Age, Expires and common request ID headers)
+	KeepDynamic   bool     // compare bodies as they are, without NormalizeBody
+}
+
+// DefaultDiffOptions returns the options used when fields of DiffOptions are left unset.
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{
+		MaxBodySize:   1 << 20,
+		IgnoreHeaders: []string{"Date", "Age", "Expires", "Cf-Ray", "X-Request-Id", "X-Amz-Cf-Id", "X-Amz-Request-Id"},
+	}
+}
+
+// ResponseDiff is the difference between two responses.
+type ResponseDiff struct {
+	OldStatus       int            `json:"old_status"`
+	NewStatus       int            `json:"new_status"`
+	Headers         []HeaderChange `json:"headers,omitempty"`
+	Body            []LineChange   `json:"body,omitempty"`
+	SimHashDistance int            `json:"simhash_distance"` // see SimHashDistance
+	Similarity      int            `json:"similarity"`       // FuzzyCompare score of the bodies
+}
+
+// HeaderChange is a header that differs between two responses.
+type HeaderChange struct {
+	Name string   `json:"name"`
+	Old  []string `json:"old,omitempty"` // nil if the header was added
+	New  []string `json:"new,omitempty"` // nil if the header was removed
+}
+
+// LineChange is a line removed from or added to a body.
+type LineChange struct {
+	Added bool   `json:"added"` // false if the line was removed
+	Line  int    `json:"line"`  // 1-based line number in the old body if removed, in the new body if added
+	Text  string `json:"text"`
+}
+
+// maxDiffEdits bounds the work of the line diff. Bodies that differ in more lines are
+// reported as entirely replaced.
+const maxDiffEdits = 2000
+
+// Changed reports whether the responses differ in status, headers or body.
+func (d *ResponseDiff) Changed() bool {
+	return d.OldStatus != d.NewStatus || len(d.Headers) > 0 || len(d.Body) > 0
+}
+
+// DiffResponses is DiffResponsesWithOptions with the default options.
+func DiffResponses(before, after *http.Response) (*ResponseDiff, error) {
+	return DiffResponsesWithOptions(before, after, DiffOptions{})
+}
+
+// DiffResponsesWithOptions compares the status, headers and body lines of two responses, e.g.
+// of the same URL in two scans. Dynamic values are removed from the bodies with NormalizeBody
+// before they are compared, unless KeepDynamic is set. The bodies are restored after reading them.
+func DiffResponsesWithOptions(before, after *http.Response, opts DiffOptions) (*ResponseDiff, error) {
+	opts = opts.withDefaults()
+	oldBody, err := peekBody(before, opts.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	newBody, err := peekBody(after, opts.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.KeepDynamic {
+		oldBody, newBody = NormalizeBody(oldBody), NormalizeBody(newBody)
+	}
+
+	d := &ResponseDiff{
+		OldStatus:       before.StatusCode,
+		NewStatus:       after.StatusCode,
+		Headers:         diffHeaders(before.Header, after.Header, opts.IgnoreHeaders),
+		Body:            diffLines(strings.Split(string(oldBody), "\n"), strings.Split(string(newBody), "\n")),
+		SimHashDistance: SimHashDistance(SimHash(oldBody), SimHash(newBody)),
+	}
+	d.Similarity, _ = FuzzyCompare(FuzzyHash(oldBody), FuzzyHash(newBody))
+	return d, nil
+}
+
+func diffHeaders(before, after http.Header, ignore []string) []HeaderChange {
+	skip := make(map[string]bool)
+	for _, name := range ignore {
+		skip[http.CanonicalHeaderKey(name)] = true
+	}
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	var changes []HeaderChange
+	for name := range names {
+		if skip[name] {
+			continue
+		}
+		if o, n := before[name], after[name]; strings.Join(o, "\n") != strings.Join(n, "\n") || len(o) != len(n) {
+			changes = append(changes, HeaderChange{Name: name, Old: o, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// diffLines returns the lines removed from a and added in b, using Myers' algorithm.
+func diffLines(a, b []string) []LineChange {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	removed := func(i int) LineChange { return LineChange{Line: prefix + i + 1, Text: a[i]} }
+	added := func(j int) LineChange { return LineChange{Added: true, Line: prefix + j + 1, Text: b[j]} }
+
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int // trace[d] holds v for diagonals -d..d before step d
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, n, m, removed, added)
+			}
+		}
+	}
+
+	// Too many edits: report the bodies as replaced.
+	var changes []LineChange
+	for i := range a {
+		changes = append(changes, removed(i))
+	}
+	for j := range b {
+		changes = append(changes, added(j))
+	}
+	return changes
+}
+
+func backtrackDiff(trace [][]int, x, y int, removed, added func(int) LineChange) []LineChange {
+	var changes []LineChange
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			changes = append(changes, added(prevY))
+		} else {
+			changes = append(changes, removed(prevX))
+		}
+		x, y = prevX, prevY
+	}
+
+	// The changes were collected from the end.
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes
+}
+
+func (o DiffOptions) withDefaults() DiffOptions {
+	def := DefaultDiffOptions()
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = def.MaxBodySize
+	}
+	if o.IgnoreHeaders == nil {
+		o.IgnoreHeaders = def.IgnoreHeaders
+	}
+	return o
+}
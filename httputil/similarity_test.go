@@ -0,0 +1,208 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// article returns a page of n paragraphs of pseudo-random words, the same for the same seed.
+func article(seed int64, n int) string {
+	words := []string{"scan", "host", "port", "route", "token", "cache", "proxy", "login", "error", "admin",
+		"server", "client", "header", "cookie", "session", "redirect", "payload", "request", "response", "domain"}
+	r := rand.New(rand.NewSource(seed))
+	var b strings.Builder
+	b.WriteString("<html><body>\n")
+	for i := 0; i < n; i++ {
+		b.WriteString("<p>")
+		for j := 0; j < 12; j++ {
+			b.WriteString(words[r.Intn(len(words))] + " ")
+		}
+		b.WriteString("</p>\n")
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+func TestNormalizeBody(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Generated at 2024-05-01T12:30:00Z", "Generated at 2023-11-20T08:01:59.123+02:00"},
+		{"Date: Wed, 01 May 2024 12:30:00 GMT", "Date: Thu, 02 May 2024 09:00:01 GMT"},
+		{"ts=1714566600 ms=1714566600123", "ts=1700000000 ms=1700000000999"},
+		{"id 0b7c5a0e-8f43-4d1f-9a2e-3c6b1d2e4f5a", "id 9f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"},
+		{`<input type="hidden" name="csrf_token" value="abc">`, `<input type="hidden" name="csrf_token" value="xyz">`},
+		{`<meta name="csrf-token" content="Zm9v">`, `<meta name="csrf-token" content="YmFy">`},
+		{`<script nonce="r4nd0m">`, `<script nonce="0th3r">`},
+		{"session deadbeefcafebabe0123", "session 0123456789abcdef9876"},
+		{"jwt eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxMjM0NTY3ODkwIn0", "jwt eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiI5ODc2NTQzMjEwIn0"},
+	}
+	for _, test := range tests {
+		if a, b := string(NormalizeBody([]byte(test.a))), string(NormalizeBody([]byte(test.b))); a != b {
+			t.Errorf("NormalizeBody(%q) = %q, NormalizeBody(%q) = %q; want equal", test.a, a, test.b, b)
+		}
+	}
+
+	kept := "/wp-content/themes/twentytwenty/assets/js/index.js a-very-long-article-slug-about-many-things"
+	if got := string(NormalizeBody([]byte(kept))); got != kept {
+		t.Errorf("NormalizeBody(%q) = %q; want unchanged", kept, got)
+	}
+}
+
+func TestSimHash(t *testing.T) {
+	page := article(1, 20)
+	edited := strings.Replace(page, "<p>", "<p>breaking news ", 1)
+	dynamic := strings.Replace(page, "<body>", "<body><!-- rendered 2024-05-01T12:30:00Z -->", 1)
+
+	if d := SimHashDistance(SimHash([]byte(page)), SimHash([]byte(dynamic))); d != 0 {
+		t.Errorf("Expected distance 0 after removing a timestamp, got %d", d)
+	}
+	if d := SimHashDistance(SimHash([]byte(page)), SimHash([]byte(edited))); d > 6 {
+		t.Errorf("Expected a small distance for a small edit, got %d", d)
+	}
+	if d := SimHashDistance(SimHash([]byte(page)), SimHash([]byte(article(2, 20)))); d < 12 {
+		t.Errorf("Expected a large distance for unrelated pages, got %d", d)
+	}
+}
+
+func TestFuzzyHash(t *testing.T) {
+	page := article(1, 40)
+	edited := strings.Replace(page, "<p>", "<p>breaking news ", 3)
+
+	hash := FuzzyHash([]byte(page))
+	if parts := strings.Split(hash, ":"); len(parts) != 3 || len(parts[1]) < spamsumLength/2 || len(parts[1]) > spamsumLength {
+		t.Errorf("FuzzyHash() = %q; want blocksize:signature:signature", hash)
+	}
+
+	tests := []struct {
+		name     string
+		other    string
+		min, max int
+	}{
+		{"identical", page, 100, 100},
+		{"edited", edited, 50, 99},
+		{"truncated", page[:len(page)*3/4], 40, 99},
+		{"unrelated", article(2, 40), 0, 0},
+		{"tiny", "<html></html>", 0, 0},
+	}
+	for _, test := range tests {
+		score, err := FuzzyCompare(hash, FuzzyHash([]byte(test.other)))
+		if err != nil {
+			t.Fatalf("FuzzyCompare failed: %v", err)
+		}
+		if score < test.min || score > test.max {
+			t.Errorf("%s: FuzzyCompare() = %d; want between %d and %d", test.name, score, test.min, test.max)
+		}
+	}
+
+	for _, invalid := range []string{"", "3:abc", "x:abc:def", "1:abc:def"} {
+		if _, err := FuzzyCompare(hash, invalid); err == nil {
+			t.Errorf("FuzzyCompare(%q) succeeded; want error", invalid)
+		}
+	}
+}
+
+func TestDiffResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", r.URL.Path)
+		switch r.URL.Path {
+		case "/before":
+			w.Header().Set("X-Version", "1")
+			w.Header().Set("X-Removed", "yes")
+			fmt.Fprint(w, "header\nline one\nline two\nline three\nupdated 2024-05-01T12:30:00Z\nfooter\n")
+		case "/after":
+			w.Header().Set("X-Version", "2")
+			w.Header().Set("X-Added", "yes")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "header\nline one\nline 2\nline three\nline four\nupdated 2024-05-02T08:00:00Z\nfooter\n")
+		}
+	}))
+	defer server.Close()
+
+	before, err := http.Get(server.URL + "/before")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer before.Body.Close()
+	after, err := http.Get(server.URL + "/after")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer after.Body.Close()
+
+	diff, err := DiffResponses(before, after)
+	if err != nil {
+		t.Fatalf("DiffResponses failed: %v", err)
+	}
+
+	if !diff.Changed() || diff.OldStatus != http.StatusOK || diff.NewStatus != http.StatusCreated {
+		t.Errorf("Expected status 200 -> 201, got %d -> %d", diff.OldStatus, diff.NewStatus)
+	}
+
+	var headers []string
+	for _, h := range diff.Headers {
+		headers = append(headers, fmt.Sprintf("%s:%v:%v", h.Name, h.Old, h.New))
+	}
+	if got, want := strings.Join(headers, " "), "Content-Length:[72]:[80] X-Added:[]:[yes] X-Removed:[yes]:[] X-Version:[1]:[2]"; got != want {
+		t.Errorf("Expected header changes %q, got %q", want, got)
+	}
+
+	var lines []string
+	for _, c := range diff.Body {
+		op := "-"
+		if c.Added {
+			op = "+"
+		}
+		lines = append(lines, fmt.Sprintf("%s%d %s", op, c.Line, c.Text))
+	}
+	if got, want := strings.Join(lines, "|"), "-3 line two|+3 line 2|+5 line four"; got != want {
+		t.Errorf("Expected body changes %q, got %q", want, got)
+	}
+	if diff.SimHashDistance == 0 || diff.Similarity == 100 {
+		t.Errorf("Expected different bodies, got distance %d and similarity %d", diff.SimHashDistance, diff.Similarity)
+	}
+
+	if body, _ := io.ReadAll(after.Body); !strings.Contains(string(body), "line four") {
+		t.Errorf("Expected the body to remain readable, got %q", body)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"a b c", "a b c", ""},
+		{"", "a", "+1 a"},
+		{"a", "", "-1 a"},
+		{"a b c d", "a c d e", "-2 b|+4 e"},
+		{"x a b", "a b y", "-1 x|+3 y"},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, c := range diffLines(strings.Fields(test.a), strings.Fields(test.b)) {
+			op := "-"
+			if c.Added {
+				op = "+"
+			}
+			got = append(got, fmt.Sprintf("%s%d %s", op, c.Line, c.Text))
+		}
+		if strings.Join(got, "|") != test.want {
+			t.Errorf("diffLines(%q, %q) = %q; want %q", test.a, test.b, strings.Join(got, "|"), test.want)
+		}
+	}
+
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	if changes := diffLines(a, b); len(changes) != 2*maxDiffEdits || changes[0].Added || !changes[maxDiffEdits].Added {
+		t.Errorf("Expected bodies beyond the edit limit to be replaced, got %d changes", len(changes))
+	}
+}
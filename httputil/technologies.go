@@ -0,0 +1,275 @@
+package httputil
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed technologies.json
+var embeddedTechnologies string
+
+// Technology is a technology detected in a response.
+type Technology struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// TechnologyRules is a parsed set of technology detection rules.
+type TechnologyRules struct {
+	rules map[string]*techRule
+}
+
+type techRule struct {
+	categories []string
+	headers    map[string][]techPattern // by canonical header name
+	cookies    map[string][]techPattern
+	html       []techPattern
+	scriptSrc  []techPattern
+	meta       map[string][]techPattern // by lowercase name
+	implies    []string
+}
+
+type techPattern struct {
+	re      *regexp.Regexp
+	version string // template such as `\1`, expanded with the submatches
+}
+
+var (
+	technologyRulesOnce sync.Once
+	technologyRules     *TechnologyRules
+)
+
+// ParseTechnologyRules parses detection rules in the Wappalyzer format: a JSON object mapping
+// technology names to their rules. The supported fields are cats (category names), headers,
+// cookies and meta (objects mapping names to patterns), html and scriptSrc (patterns) and
+// implies (technology names). Patterns are case-insensitive regular expressions, optionally
+// followed by `\;version:\1` to extract a version from a submatch. An empty pattern matches
+// any value.
+func ParseTechnologyRules(r io.Reader) (*TechnologyRules, error) {
+	var raw map[string]struct {
+		Cats      []string               `json:"cats"`
+		Headers   map[string]patternList `json:"headers"`
+		Cookies   map[string]patternList `json:"cookies"`
+		HTML      patternList            `json:"html"`
+		ScriptSrc patternList            `json:"scriptSrc"`
+		Scripts   patternList            `json:"scripts"`
+		Meta      map[string]patternList `json:"meta"`
+		Implies   patternList            `json:"implies"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid technology rules: %v", err)
+	}
+
+	rules := &TechnologyRules{rules: make(map[string]*techRule, len(raw))}
+	for name, t := range raw {
+		rule := &techRule{
+			categories: t.Cats,
+			headers:    make(map[string][]techPattern),
+			cookies:    make(map[string][]techPattern),
+			meta:       make(map[string][]techPattern),
+		}
+		var err error
+		for key, patterns := range t.Headers {
+			if rule.headers[http.CanonicalHeaderKey(key)], err = compilePatterns(patterns); err != nil {
+				return nil, fmt.Errorf("technology %q: %v", name, err)
+			}
+		}
+		for key, patterns := range t.Cookies {
+			if rule.cookies[key], err = compilePatterns(patterns); err != nil {
+				return nil, fmt.Errorf("technology %q: %v", name, err)
+			}
+		}
+		for key, patterns := range t.Meta {
+			if rule.meta[strings.ToLower(key)], err = compilePatterns(patterns); err != nil {
+				return nil, fmt.Errorf("technology %q: %v", name, err)
+			}
+		}
+		if rule.html, err = compilePatterns(t.HTML); err != nil {
+			return nil, fmt.Errorf("technology %q: %v", name, err)
+		}
+		if rule.scriptSrc, err = compilePatterns(append(t.ScriptSrc, t.Scripts...)); err != nil {
+			return nil, fmt.Errorf("technology %q: %v", name, err)
+		}
+		for _, implied := range t.Implies {
+			// Drop modifiers such as \;confidence:50.
+			implied, _, _ = strings.Cut(implied, `\;`)
+			rule.implies = append(rule.implies, implied)
+		}
+		rules.rules[name] = rule
+	}
+	return rules, nil
+}
+
+// LoadTechnologyRules parses technology detection rules from a file.
+func LoadTechnologyRules(filePath string) (*TechnologyRules, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTechnologyRules(f)
+}
+
+// DefaultTechnologyRules returns the rule set embedded in the package, which covers common
+// web servers, CDNs, languages, frameworks, CMSs and JavaScript libraries.
+func DefaultTechnologyRules() *TechnologyRules {
+	technologyRulesOnce.Do(func() {
+		rules, err := ParseTechnologyRules(strings.NewReader(embeddedTechnologies))
+		if err != nil {
+			panic("httputil: embedded technology rules: " + err.Error())
+		}
+		technologyRules = rules
+	})
+	return technologyRules
+}
+
+// Len returns the number of technologies in the rule set.
+func (r *TechnologyRules) Len() int {
+	return len(r.rules)
+}
+
+// match returns the technologies detected in resp, whose body and parsed page are given,
+// including those they imply, sorted by name.
+func (r *TechnologyRules) match(resp *http.Response, body string, page pageInfo) []Technology {
+	cookies := make(map[string]string)
+	for _, c := range resp.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+
+	found := make(map[string]string)
+	var queue []string
+	for name, rule := range r.rules {
+		if version, ok := rule.match(resp.Header, cookies, body, page); ok {
+			found[name] = version
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		rule, ok := r.rules[name]
+		if !ok {
+			continue
+		}
+		for _, implied := range rule.implies {
+			if _, ok := found[implied]; !ok {
+				found[implied] = ""
+				queue = append(queue, implied)
+			}
+		}
+	}
+
+	techs := make([]Technology, 0, len(found))
+	for name, version := range found {
+		tech := Technology{Name: name, Version: version}
+		if rule, ok := r.rules[name]; ok {
+			tech.Categories = rule.categories
+		}
+		techs = append(techs, tech)
+	}
+	sort.Slice(techs, func(i, j int) bool { return techs[i].Name < techs[j].Name })
+	return techs
+}
+
+// match reports whether any pattern of the rule matches, along with the first version found.
+func (t *techRule) match(header http.Header, cookies map[string]string, body string, page pageInfo) (string, bool) {
+	var version string
+	var matched bool
+	try := func(patterns []techPattern, value string) {
+		for _, p := range patterns {
+			if m := p.re.FindStringSubmatch(value); m != nil {
+				matched = true
+				if version == "" {
+					version = p.expand(m)
+				}
+			}
+		}
+	}
+
+	for key, patterns := range t.headers {
+		for _, value := range header.Values(key) {
+			try(patterns, value)
+		}
+	}
+	for name, patterns := range t.cookies {
+		if value, ok := cookies[name]; ok {
+			try(patterns, value)
+		}
+	}
+	for name, patterns := range t.meta {
+		if value, ok := page.meta[name]; ok {
+			try(patterns, value)
+		}
+	}
+	for _, src := range page.scripts {
+		try(t.scriptSrc, src)
+	}
+	if len(t.html) > 0 && body != "" {
+		try(t.html, body)
+	}
+	return version, matched
+}
+
+var submatchRefRegex = regexp.MustCompile(`\\(\d)`)
+
+// expand substitutes the submatches of m into the version template of the pattern.
+func (p techPattern) expand(m []string) string {
+	if p.version == "" {
+		return ""
+	}
+	version := submatchRefRegex.ReplaceAllStringFunc(p.version, func(ref string) string {
+		i, _ := strconv.Atoi(ref[1:])
+		if i < len(m) {
+			return m[i]
+		}
+		return ""
+	})
+	return strings.TrimSpace(version)
+}
+
+func compilePatterns(patterns []string) ([]techPattern, error) {
+	var compiled []techPattern
+	for _, pattern := range patterns {
+		fields := strings.Split(pattern, `\;`)
+		re, err := regexp.Compile("(?i)" + fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		p := techPattern{re: re}
+		for _, field := range fields[1:] {
+			if value, ok := strings.CutPrefix(field, "version:"); ok {
+				p.version = value
+			}
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// patternList is a JSON string or array of strings.
+type patternList []string
+
+func (l *patternList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = patternList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
@@ -2,6 +2,7 @@ package iputil
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -377,9 +378,21 @@ func IsIPInRange(ip string, ipRange string) bool {
 	return false
 }
 
+// PTRResolver performs the lookups needed by GetPTRsWithResolver.
+// It is implemented by *net.Resolver and *domainutil.Cache.
+type PTRResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
 // GetPTRs returns the PTR record for the given IP address.
 func GetPTRs(ip string) ([]string, error) {
-	names, err := net.LookupAddr(ip)
+	return GetPTRsWithResolver(context.Background(), net.DefaultResolver, ip)
+}
+
+// GetPTRsWithResolver returns the PTR records for the given IP address that resolve back to it, using r for all lookups.
+func GetPTRsWithResolver(ctx context.Context, r PTRResolver, ip string) ([]string, error) {
+	names, err := r.LookupAddr(ctx, ip)
 	if err != nil {
 		return nil, err
 	}
@@ -388,10 +401,10 @@ func GetPTRs(ip string) ([]string, error) {
 	for _, name := range names {
 		trimmedName := strings.TrimSuffix(name, ".")
 
-		ips, err := net.LookupIP(trimmedName)
+		addrs, err := r.LookupIPAddr(ctx, trimmedName)
 		if err == nil {
-			for _, resolvedIP := range ips {
-				if resolvedIP.String() == ip {
+			for _, resolvedIP := range addrs {
+				if resolvedIP.IP.String() == ip {
 					validNames = append(validNames, trimmedName)
 					break
 				}
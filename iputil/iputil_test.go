@@ -1,6 +1,7 @@
 package iputil
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"reflect"
@@ -368,6 +369,39 @@ func TestReverseDNSLookup(t *testing.T) {
 	})
 }
 
+// fakePTRResolver answers from fixed data.
+type fakePTRResolver struct {
+	names map[string][]string
+	addrs map[string][]string
+}
+
+func (r fakePTRResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return r.names[addr], nil
+}
+
+func (r fakePTRResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	for _, ip := range r.addrs[host] {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestGetPTRsWithResolver(t *testing.T) {
+	r := fakePTRResolver{
+		names: map[string][]string{"192.0.2.1": {"host.example.com.", "stale.example.com."}},
+		addrs: map[string][]string{"host.example.com": {"192.0.2.1"}, "stale.example.com": {"192.0.2.99"}},
+	}
+
+	names, err := GetPTRsWithResolver(context.Background(), r, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("GetPTRsWithResolver() error = %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"host.example.com"}) {
+		t.Errorf("GetPTRsWithResolver() = %v, want [host.example.com]", names)
+	}
+}
+
 func TestParseCIDR(t *testing.T) {
 	t.Run("valid CIDR", func(t *testing.T) {
 		cidr := "192.168.1.0/30"
@@ -0,0 +1,240 @@
+package netutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures InspectTLS.
+type TLSOptions struct {
+	ServerName string         // server name sent with SNI and checked against the certificate (default: host of the address)
+	NoSNI      bool           // send no server name, to get the server's default certificate
+	Timeout    time.Duration  // timeout for connecting and the handshake (default 10s)
+	Dialer     ContextDialer  // dialer used to connect, e.g. a ProxyDialer (default: net.Dialer)
+	Roots      *x509.CertPool // roots the chain is verified against (default: system roots)
+}
+
+// DefaultTLSOptions returns the options used when fields of TLSOptions are left unset.
+func DefaultTLSOptions() TLSOptions {
+	return TLSOptions{
+		Timeout: 10 * time.Second,
+		Dialer:  &net.Dialer{},
+	}
+}
+
+// TLSInfo is the outcome of a TLS handshake.
+type TLSInfo struct {
+	Address     string            `json:"address"`
+	ServerName  string            `json:"server_name,omitempty"` // name sent with SNI, empty if none was sent
+	Version     string            `json:"version"`
+	CipherSuite string            `json:"cipher_suite"`
+	ALPN        string            `json:"alpn,omitempty"`
+	Chain       []CertificateInfo `json:"chain"` // as sent by the server, leaf first
+	SelfSigned  bool              `json:"self_signed"`
+	Expired     bool              `json:"expired"`  // the leaf certificate is expired or not yet valid
+	Mismatch    bool              `json:"mismatch"` // the leaf certificate is not valid for the server name or host
+	Untrusted   bool              `json:"untrusted"`
+	VerifyError string            `json:"verify_error,omitempty"` // why the chain is untrusted
+}
+
+// CertificateInfo describes a certificate.
+type CertificateInfo struct {
+	Subject            string    `json:"subject"`
+	CommonName         string    `json:"common_name,omitempty"`
+	Issuer             string    `json:"issuer"`
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	IPAddresses        []string  `json:"ip_addresses,omitempty"`
+	EmailAddresses     []string  `json:"email_addresses,omitempty"`
+	SerialNumber       string    `json:"serial_number"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	KeyType            string    `json:"key_type"` // RSA, ECDSA or Ed25519
+	KeyBits            int       `json:"key_bits"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	IsCA               bool      `json:"is_ca"`
+	SHA1Fingerprint    string    `json:"sha1_fingerprint"`
+	SHA256Fingerprint  string    `json:"sha256_fingerprint"`
+}
+
+// InspectTLS performs a TLS handshake with address (host:port) without verifying the server,
+// and returns the negotiated parameters and the details of the certificate chain. The chain is
+// then checked separately: the result flags self-signed, expired and untrusted certificates, and
+// certificates not valid for the server name, or for the host of address if no name is sent.
+func InspectTLS(ctx context.Context, address string, opts TLSOptions) (*TLSInfo, error) {
+	opts = opts.withDefaults()
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	serverName := opts.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	config := &tls.Config{InsecureSkipVerify: true}
+	if !opts.NoSNI && net.ParseIP(serverName) == nil {
+		config.ServerName = serverName
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	conn, err := opts.Dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificate from %s", address)
+	}
+
+	info := &TLSInfo{
+		Address:     address,
+		ServerName:  config.ServerName,
+		Version:     TLSVersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, certificateInfo(cert))
+	}
+
+	leaf := state.PeerCertificates[0]
+	now := time.Now()
+	info.SelfSigned = bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil
+	info.Expired = now.After(leaf.NotAfter) || now.Before(leaf.NotBefore)
+	info.Mismatch = leaf.VerifyHostname(serverName) != nil
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: opts.Roots, Intermediates: intermediates}); err != nil {
+		info.Untrusted = true
+		info.VerifyError = err.Error()
+	}
+	return info, nil
+}
+
+// HarvestTLSNames performs a handshake with address with SNI and one without, and returns the
+// DNS names of both leaf certificates, lowercased, deduplicated and sorted. Servers often return
+// a default certificate without SNI that names other hosts. Only the handshake without SNI is
+// made if opts.NoSNI is set, or if address is an IP address and opts.ServerName is empty. An
+// error is returned only if no handshake succeeds.
+func HarvestTLSNames(ctx context.Context, address string, opts TLSOptions) ([]string, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	modes := []bool{false, true}
+	if opts.NoSNI || (opts.ServerName == "" && net.ParseIP(host) != nil) {
+		modes = []bool{true}
+	}
+
+	names := make(map[string]bool)
+	var lastErr error
+	succeeded := false
+	for _, noSNI := range modes {
+		o := opts
+		o.NoSNI = noSNI
+		info, err := InspectTLS(ctx, address, o)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		succeeded = true
+		leaf := info.Chain[0]
+		for _, name := range append([]string{leaf.CommonName}, leaf.DNSNames...) {
+			if name = strings.ToLower(strings.TrimSuffix(name, ".")); name != "" && net.ParseIP(name) == nil {
+				names[name] = true
+			}
+		}
+	}
+	if !succeeded {
+		return nil, lastErr
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// TLSVersionName returns the name of a TLS version, e.g. "TLS 1.3".
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	info := CertificateInfo{
+		Subject:            cert.Subject.String(),
+		CommonName:         cert.Subject.CommonName,
+		Issuer:             cert.Issuer.String(),
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		SerialNumber:       hex.EncodeToString(cert.SerialNumber.Bytes()),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+		SHA1Fingerprint:    hex.EncodeToString(sha1Sum[:]),
+		SHA256Fingerprint:  hex.EncodeToString(sha256Sum[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType, info.KeyBits = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeyBits = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyType, info.KeyBits = "Ed25519", 256
+	default:
+		info.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+	return info
+}
+
+func (o TLSOptions) withDefaults() TLSOptions {
+	def := DefaultTLSOptions()
+	if o.Timeout <= 0 {
+		o.Timeout = def.Timeout
+	}
+	if o.Dialer == nil {
+		o.Dialer = def.Dialer
+	}
+	return o
+}
@@ -0,0 +1,157 @@
+package netutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSNIServer starts a TLS server that presents an expired certificate for sni.test and
+// www.sni.test when asked for sni.test, and the default httptest certificate otherwise.
+func newSNIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "sni.test"},
+		DNSNames:     []string{"sni.test", "www.sni.test"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sniCert := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "sni.test" {
+				return sniCert, nil
+			}
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInspectTLS(t *testing.T) {
+	server := newSNIServer(t)
+	address := server.Listener.Addr().String()
+
+	info, err := InspectTLS(context.Background(), address, TLSOptions{})
+	if err != nil {
+		t.Fatalf("InspectTLS failed: %v", err)
+	}
+	if info.ServerName != "" || info.Version != "TLS 1.3" || info.CipherSuite == "" || len(info.Chain) == 0 {
+		t.Errorf("Expected a TLS 1.3 handshake without SNI, got %+v", info)
+	}
+	leaf := info.Chain[0]
+	if leaf.SerialNumber == "" || len(leaf.SHA1Fingerprint) != 40 || len(leaf.SHA256Fingerprint) != 64 ||
+		leaf.KeyType == "" || leaf.KeyBits == 0 || leaf.NotAfter.IsZero() || len(leaf.IPAddresses) == 0 {
+		t.Errorf("Expected certificate details, got %+v", leaf)
+	}
+	if !info.SelfSigned || info.Expired || info.Mismatch || !info.Untrusted || info.VerifyError == "" {
+		t.Errorf("Expected a valid self-signed certificate, got %+v", info)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	info, err = InspectTLS(context.Background(), address, TLSOptions{Roots: roots})
+	if err != nil {
+		t.Fatalf("InspectTLS failed: %v", err)
+	}
+	if info.Untrusted {
+		t.Errorf("Expected the certificate to be trusted by its own pool, got %s", info.VerifyError)
+	}
+
+	info, err = InspectTLS(context.Background(), address, TLSOptions{ServerName: "sni.test"})
+	if err != nil {
+		t.Fatalf("InspectTLS failed: %v", err)
+	}
+	leaf = info.Chain[0]
+	if info.ServerName != "sni.test" || leaf.CommonName != "sni.test" || leaf.KeyType != "ECDSA" || leaf.KeyBits != 256 {
+		t.Errorf("Expected the SNI certificate, got %+v", info)
+	}
+	if !info.Expired || info.Mismatch || !info.SelfSigned {
+		t.Errorf("Expected an expired self-signed certificate matching sni.test, got %+v", info)
+	}
+
+	info, err = InspectTLS(context.Background(), address, TLSOptions{ServerName: "other.test"})
+	if err != nil {
+		t.Fatalf("InspectTLS failed: %v", err)
+	}
+	if !info.Mismatch {
+		t.Errorf("Expected a mismatch for other.test, got %+v", info.Chain[0].DNSNames)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	if _, err := InspectTLS(context.Background(), closed, TLSOptions{Timeout: time.Second}); err == nil {
+		t.Errorf("Expected error for closed port")
+	}
+	if _, err := InspectTLS(context.Background(), "127.0.0.1", TLSOptions{}); err == nil {
+		t.Errorf("Expected error for address without port")
+	}
+}
+
+func TestHarvestTLSNames(t *testing.T) {
+	server := newSNIServer(t)
+	address := server.Listener.Addr().String()
+
+	names, err := HarvestTLSNames(context.Background(), address, TLSOptions{ServerName: "sni.test"})
+	if err != nil {
+		t.Fatalf("HarvestTLSNames failed: %v", err)
+	}
+	got := strings.Join(names, " ")
+	for _, want := range []string{"example.com", "sni.test", "www.sni.test"} {
+		if !strings.Contains(" "+got+" ", " "+want+" ") {
+			t.Errorf("HarvestTLSNames() = %v; want it to contain %s", names, want)
+		}
+	}
+
+	names, err = HarvestTLSNames(context.Background(), address, TLSOptions{})
+	if err != nil {
+		t.Fatalf("HarvestTLSNames failed: %v", err)
+	}
+	if strings.Contains(strings.Join(names, " "), "sni.test") {
+		t.Errorf("Expected only the default certificate without a server name, got %v", names)
+	}
+}
+
+func TestTLSVersionName(t *testing.T) {
+	tests := []struct {
+		version uint16
+		want    string
+	}{
+		{tls.VersionTLS12, "TLS 1.2"},
+		{tls.VersionTLS13, "TLS 1.3"},
+		{0x0300, "0x0300"},
+	}
+	for _, test := range tests {
+		if got := TLSVersionName(test.version); got != test.want {
+			t.Errorf("TLSVersionName(%#x) = %q; want %q", test.version, got, test.want)
+		}
+	}
+}
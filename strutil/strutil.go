@@ -1,6 +1,7 @@
 package strutil
 
 import (
+	"math/rand"
 	"strconv"
 	"strings"
 	"unicode"
@@ -31,3 +32,14 @@ func IsBinaryString(str string) bool {
 	}
 	return false
 }
+
+// RandomLabel returns a random string of n lowercase letters and digits, usable as a DNS
+// label or URL path segment that is very unlikely to exist.
+func RandomLabel(n int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(b)
+}
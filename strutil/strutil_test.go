@@ -39,3 +39,15 @@ func TestIsBinaryString(t *testing.T) {
 		t.Error("IsBinaryString failed, expected false, got true")
 	}
 }
+
+func TestRandomLabel(t *testing.T) {
+	a, b := RandomLabel(16), RandomLabel(16)
+	if len(a) != 16 || a == b {
+		t.Errorf("RandomLabel(16) = %q, %q; want two different 16-character labels", a, b)
+	}
+	for _, c := range a {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			t.Errorf("RandomLabel(16) = %q; want only lowercase letters and digits", a)
+		}
+	}
+}
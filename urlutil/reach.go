@@ -0,0 +1,246 @@
+package urlutil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReachResult holds the outcome of a reachability check for a single URL.
+type ReachResult struct {
+	URL  string
+	Addr string // host:port that was dialed
+	Err  error  // nil if the address could be reached
+}
+
+// ReachOptions controls how CanReachURLs dials its targets.
+type ReachOptions struct {
+	Concurrency int           // maximum number of dials in flight (default 100)
+	PerHost     int           // maximum number of dials in flight per hostname (default 4)
+	Timeout     time.Duration // timeout for each dial (default 5s)
+
+	// Dial connects to a host:port, e.g. (*domainutil.Cache).DialContext to share resolutions
+	// across checks. Defaults to a net.Dialer.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DefaultReachOptions returns the options used when fields of ReachOptions are left unset.
+func DefaultReachOptions() ReachOptions {
+	return ReachOptions{
+		Concurrency: 100,
+		PerHost:     4,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// CanReachURLs checks a stream of URLs for TCP reachability and streams back one result per URL.
+// URLs sharing the same host:port are only dialed once, and the result is reported for each of them.
+// The returned channel is closed once every URL read from urls has been reported, or when ctx is done.
+func CanReachURLs(ctx context.Context, urls <-chan string, opts ReachOptions) <-chan ReachResult {
+	opts = opts.withDefaults()
+	results := make(chan ReachResult)
+
+	c := &reachChecker{
+		opts:    opts,
+		results: results,
+		global:  make(chan struct{}, opts.Concurrency),
+		hosts:   make(map[string]chan struct{}),
+		addrs:   make(map[string]*reachEntry),
+	}
+
+	go func() {
+		defer close(results)
+		defer c.wg.Wait()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case rawURL, ok := <-urls:
+				if !ok {
+					return
+				}
+				c.add(ctx, rawURL)
+			}
+		}
+	}()
+
+	return results
+}
+
+// CanReachURLsSlice is like CanReachURLs but takes its input from a slice.
+func CanReachURLsSlice(ctx context.Context, urls []string, opts ReachOptions) <-chan ReachResult {
+	in := make(chan string)
+	go func() {
+		defer close(in)
+		for _, u := range urls {
+			select {
+			case in <- u:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return CanReachURLs(ctx, in, opts)
+}
+
+type reachEntry struct {
+	done    bool
+	err     error
+	waiting []string
+}
+
+type reachChecker struct {
+	opts    ReachOptions
+	results chan<- ReachResult
+	global  chan struct{}
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+	addrs map[string]*reachEntry
+	wg    sync.WaitGroup
+}
+
+func (c *reachChecker) add(ctx context.Context, rawURL string) {
+	addr, host, err := reachAddr(rawURL)
+	if err != nil {
+		c.emit(ctx, ReachResult{URL: rawURL, Err: err})
+		return
+	}
+
+	c.mu.Lock()
+	entry, seen := c.addrs[addr]
+	if !seen {
+		entry = &reachEntry{}
+		c.addrs[addr] = entry
+	}
+	if !entry.done {
+		entry.waiting = append(entry.waiting, rawURL)
+		c.mu.Unlock()
+		if !seen {
+			c.wg.Add(1)
+			go c.dial(ctx, addr, host)
+		}
+		return
+	}
+	err = entry.err
+	c.mu.Unlock()
+
+	c.emit(ctx, ReachResult{URL: rawURL, Addr: addr, Err: err})
+}
+
+func (c *reachChecker) dial(ctx context.Context, addr, host string) {
+	defer c.wg.Done()
+
+	err := c.acquire(ctx, host)
+	if err == nil {
+		dialCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		var conn net.Conn
+		conn, err = c.opts.Dial(dialCtx, "tcp", addr)
+		cancel()
+		if err == nil {
+			conn.Close()
+		}
+		c.release(host)
+	}
+
+	c.mu.Lock()
+	entry := c.addrs[addr]
+	entry.done = true
+	entry.err = err
+	waiting := entry.waiting
+	entry.waiting = nil
+	c.mu.Unlock()
+
+	for _, rawURL := range waiting {
+		c.emit(ctx, ReachResult{URL: rawURL, Addr: addr, Err: err})
+	}
+}
+
+// acquire takes a per-host slot before a global one, so that goroutines
+// waiting on a busy host do not hold up dials to other hosts.
+func (c *reachChecker) acquire(ctx context.Context, host string) error {
+	c.mu.Lock()
+	sem, ok := c.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, c.opts.PerHost)
+		c.hosts[host] = sem
+	}
+	c.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case c.global <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		<-sem
+		return ctx.Err()
+	}
+}
+
+func (c *reachChecker) release(host string) {
+	<-c.global
+	c.mu.Lock()
+	sem := c.hosts[host]
+	c.mu.Unlock()
+	<-sem
+}
+
+func (c *reachChecker) emit(ctx context.Context, r ReachResult) {
+	select {
+	case c.results <- r:
+	case <-ctx.Done():
+	}
+}
+
+func (o ReachOptions) withDefaults() ReachOptions {
+	def := DefaultReachOptions()
+	if o.Concurrency <= 0 {
+		o.Concurrency = def.Concurrency
+	}
+	if o.PerHost <= 0 {
+		o.PerHost = def.PerHost
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = def.Timeout
+	}
+	if o.Dial == nil {
+		var d net.Dialer
+		o.Dial = d.DialContext
+	}
+	return o
+}
+
+// reachAddr returns the host:port to dial for rawURL along with its lowercased hostname, which
+// addresses are deduplicated and limited by. URLs without a port use the port of their scheme.
+func reachAddr(rawURL string) (addr string, host string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	host = strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", "", fmt.Errorf("missing host in URL: %s", rawURL)
+	}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return "", "", fmt.Errorf("missing port in URL: %s", rawURL)
+		}
+	}
+	return net.JoinHostPort(host, port), host, nil
+}
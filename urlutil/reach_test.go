@@ -0,0 +1,192 @@
+package urlutil
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCanReachURLs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up mock server: %v", err)
+	}
+	defer ln.Close()
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			conn.Close()
+		}
+	}()
+
+	// Grab a free port and close it so it is known to be unreachable.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up mock server: %v", err)
+	}
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	open := "http://" + ln.Addr().String()
+	urls := []string{
+		open + "/a",
+		open + "/b",
+		open + "/c",
+		"http://127.0.0.1:" + closedPort + "/",
+		"http://[::1",
+	}
+
+	got := make(map[string]error)
+	for r := range CanReachURLsSlice(context.Background(), urls, ReachOptions{Timeout: time.Second}) {
+		got[r.URL] = r.Err
+	}
+
+	if len(got) != len(urls) {
+		t.Fatalf("Expected %d results, got %d", len(urls), len(got))
+	}
+	for _, u := range urls[:3] {
+		if got[u] != nil {
+			t.Errorf("Expected %s to be reachable, got %v", u, got[u])
+		}
+	}
+	if got[urls[3]] == nil {
+		t.Errorf("Expected %s to be unreachable", urls[3])
+	}
+	if got[urls[4]] == nil {
+		t.Errorf("Expected parse error for %s", urls[4])
+	}
+
+	// Accepts happen asynchronously; give the listener a moment.
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("Expected a single dial to %s, got %d", ln.Addr(), n)
+	}
+}
+
+func TestReachCheckerPerHostLimit(t *testing.T) {
+	c := &reachChecker{
+		opts:   ReachOptions{Concurrency: 10, PerHost: 2},
+		global: make(chan struct{}, 10),
+		hosts:  make(map[string]chan struct{}),
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := c.acquire(ctx, "example.com"); err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		c.acquire(ctx, "example.com")
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Expected third acquire for the same host to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Other hosts are not affected by the busy one.
+	if err := c.acquire(ctx, "example.org"); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	c.release("example.com")
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected blocked acquire to proceed after release")
+	}
+}
+
+func TestCanReachURLsContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string)
+	results := CanReachURLs(ctx, in, ReachOptions{})
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Errorf("Expected results channel to be closed after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Results channel was not closed after cancel")
+	}
+}
+
+func TestCanReachURLsCustomDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to set up mock server: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	var dials int32
+	opts := ReachOptions{
+		Timeout: time.Second,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			// Resolve every name to the mock server.
+			_, p, _ := net.SplitHostPort(address)
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort("127.0.0.1", p))
+		},
+	}
+
+	urls := []string{"http://app.test:" + port + "/", "http://api.test:" + port + "/"}
+	for r := range CanReachURLsSlice(context.Background(), urls, opts) {
+		if r.Err != nil {
+			t.Errorf("Expected %s to be reachable through the custom dialer, got %v", r.URL, r.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("Expected 2 dials through the custom dialer, got %d", n)
+	}
+}
+
+func TestReachAddr(t *testing.T) {
+	tests := []struct {
+		input   string
+		addr    string
+		host    string
+		wantErr bool
+	}{
+		{"http://example.com", "example.com:80", "example.com", false},
+		{"https://Example.COM/path", "example.com:443", "example.com", false},
+		{"http://example.com:8080", "example.com:8080", "example.com", false},
+		{"http://[::1]/", "[::1]:80", "::1", false},
+		{"https://[2001:db8::1]:8443", "[2001:db8::1]:8443", "2001:db8::1", false},
+		{"ftp://example.com", "", "", true},
+		{"http://", "", "", true},
+	}
+
+	for _, test := range tests {
+		addr, host, err := reachAddr(test.input)
+		if (err != nil) != test.wantErr || addr != test.addr || host != test.host {
+			t.Errorf("reachAddr(%s) = %s, %s, %v; want %s, %s", test.input, addr, host, err, test.addr, test.host)
+		}
+	}
+}
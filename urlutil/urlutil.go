@@ -1,6 +1,7 @@
 package urlutil
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -10,8 +11,6 @@ import (
 	"time"
 
 	"github.com/root4loot/goutils/domainutil"
-	"github.com/root4loot/goutils/iputil"
-	"github.com/root4loot/goutils/netutil"
 )
 
 // IsURL checks if a string is a URL.
@@ -27,50 +26,29 @@ func IsValidURL(urlStr string) bool {
 }
 
 // CanReachURL checks if a URL can be reached without a timeout.
+// Hostnames are resolved through domainutil.DefaultCache.
 func CanReachURL(rawURL string) error {
-	var err error
-
-	rawURL = EnsurePortIsSet(rawURL)
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return err
-	}
-
-	conn, err := net.Dial("tcp", u.Host)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	return err
+	return canReachURL(context.Background(), rawURL)
 }
 
 // CanReachURLWithTimeout checks if a URL can be reached with a specified timeout.
+// Hostnames are resolved through domainutil.DefaultCache.
 func CanReachURLWithTimeout(rawURL string, timeout time.Duration) error {
-	var err error
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return canReachURL(ctx, rawURL)
+}
 
-	rawURL = EnsurePortIsSet(rawURL)
-	u, err := url.Parse(rawURL)
+func canReachURL(ctx context.Context, rawURL string) error {
+	addr, _, err := reachAddr(rawURL)
 	if err != nil {
 		return err
 	}
-
-	if iputil.IsURLIP(rawURL) {
-		if netutil.CanDialWithTimeout(u.Hostname(), u.Port(), timeout) {
-			return err
-		}
-	}
-
-	ip, err := domainutil.ResolveDomainWithTimeout(u.Hostname(), timeout)
+	conn, err := domainutil.DefaultCache().DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return err
 	}
-
-	if netutil.CanDialWithTimeout(ip, u.Port(), timeout) {
-		return err
-	}
-
-	return err
+	return conn.Close()
 }
 
 // EnsurePortIsSet ensures a URL has a port set. If no port is provided, it defaults to 80 for HTTP and 443 for HTTPS.
@@ -83,9 +61,9 @@ func EnsurePortIsSet(rawURL string) string {
 	if u.Port() == "" {
 		switch u.Scheme {
 		case "http":
-			u.Host = u.Hostname() + ":80"
+			u.Host = net.JoinHostPort(u.Hostname(), "80")
 		case "https":
-			u.Host = u.Hostname() + ":443"
+			u.Host = net.JoinHostPort(u.Hostname(), "443")
 		}
 	}
 
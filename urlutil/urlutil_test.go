@@ -1,6 +1,7 @@
 package urlutil
 
 import (
+	"net"
 	"net/url"
 	"testing"
 	"time"
@@ -41,6 +42,22 @@ func TestCanReachURLWithTimeout(t *testing.T) {
 	}
 }
 
+func TestCanReachURLLocal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	if err := CanReachURLWithTimeout("http://localhost:"+port, time.Second); err != nil {
+		t.Errorf("CanReachURLWithTimeout(localhost:%s) returned error: %v", port, err)
+	}
+	ln.Close()
+	if err := CanReachURLWithTimeout("http://127.0.0.1:"+port, time.Second); err == nil {
+		t.Errorf("Expected error for closed port")
+	}
+}
+
 func TestEnsurePortIsSet(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -49,6 +66,7 @@ func TestEnsurePortIsSet(t *testing.T) {
 		{"http://example.com", "http://example.com:80"},
 		{"https://example.com", "https://example.com:443"},
 		{"http://example.com:8080", "http://example.com:8080"},
+		{"http://[::1]/", "http://[::1]:80/"},
 	}
 
 	for _, test := range tests {